@@ -0,0 +1,80 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+// aggregate is a read-only view over several counters, computed at query
+// time.
+type aggregate struct {
+	cs   []Counter
+	fold func(a, b int64) int64
+}
+
+// NewSumCounter creates a counter whose count is the sum of the counts of cs.
+//
+// The aggregates are read-only views: Advance and Radvance only move the
+// children to now, ignoring delta, Revoke does not change the children
+// and Zero is a no-op. The Duration is the longest of the children.
+func NewSumCounter(cs ...Counter) Counter {
+	return &aggregate{cs, func(a, b int64) int64 { return a + b }}
+}
+
+// NewMinCounter is like NewSumCounter, but with the minimum of the counts.
+func NewMinCounter(cs ...Counter) Counter {
+	return &aggregate{cs, func(a, b int64) int64 {
+		if b < a {
+			return b
+		}
+		return a
+	}}
+}
+
+// NewMaxCounter is like NewSumCounter, but with the maximum of the counts.
+func NewMaxCounter(cs ...Counter) Counter {
+	return &aggregate{cs, func(a, b int64) int64 {
+		if b > a {
+			return b
+		}
+		return a
+	}}
+}
+
+func (c *aggregate) collect(count func(Counter) int64) int64 {
+	if len(c.cs) == 0 {
+		return 0
+	}
+	v := count(c.cs[0])
+	for _, child := range c.cs[1:] {
+		v = c.fold(v, count(child))
+	}
+	return v
+}
+
+func (c *aggregate) Advance(now int64, delta int64) int64 {
+	return c.collect(func(child Counter) int64 {
+		return child.Advance(now, 0)
+	})
+}
+
+func (c *aggregate) Revoke(hist int64, delta int64) int64 {
+	return c.collect(func(child Counter) int64 {
+		return child.Revoke(hist, 0)
+	})
+}
+
+func (c *aggregate) Radvance(now, hist int64, delta int64) int64 {
+	return c.Advance(now, 0)
+}
+
+func (c *aggregate) Zero() {}
+
+func (c *aggregate) Duration() int64 {
+	var dur int64
+	for _, child := range c.cs {
+		if d := child.Duration(); d > dur {
+			dur = d
+		}
+	}
+	return dur
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Flusher is a counter that buffers its updates.
+type Flusher interface {
+	// Flush applies the buffered updates.
+	Flush()
+	// Close stops buffering and applies the remaining updates.
+	Close()
+}
+
+// DefaultFlushEvery is the flush period of NewBatchingCounter when none is
+// given.
+const DefaultFlushEvery = 100 * time.Millisecond
+
+type batching struct {
+	c   Counter
+	now func() int64
+
+	pending int64
+	last    int64
+	closed  int32
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewBatchingCounter wraps c so that Advance only adds the delta to a local
+// buffer, which is applied to c with a single Advance at now() every
+// flushEvery.
+//
+// The moments passed to Advance are ignored, and the counts it returns are
+// the last flushed count plus the buffered deltas, so reads may lag behind
+// the underlying counter by up to flushEvery. A non-positive flushEvery
+// means DefaultFlushEvery.
+//
+// The flushes run on a goroutine, which is stopped by Close, see Flusher.
+func NewBatchingCounter(c Counter, flushEvery time.Duration, now func() int64) Counter {
+	if flushEvery <= 0 {
+		flushEvery = DefaultFlushEvery
+	}
+	b := &batching{
+		c:    c,
+		now:  now,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	b.last = c.Advance(now(), 0)
+	go b.loop(flushEvery)
+	return b
+}
+
+func (b *batching) loop(flushEvery time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *batching) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delta := atomic.SwapInt64(&b.pending, 0)
+	atomic.StoreInt64(&b.last, b.c.Advance(b.now(), delta))
+}
+
+func (b *batching) Close() {
+	b.once.Do(func() {
+		atomic.StoreInt32(&b.closed, 1)
+		close(b.stop)
+		<-b.done
+	})
+	b.Flush()
+}
+
+func (b *batching) Advance(now int64, delta int64) int64 {
+	if atomic.LoadInt32(&b.closed) != 0 {
+		b.Flush()
+		return b.c.Advance(now, delta)
+	}
+	pending := atomic.AddInt64(&b.pending, delta)
+	if atomic.LoadInt32(&b.closed) != 0 {
+		b.Flush()
+		return atomic.LoadInt64(&b.last)
+	}
+	return atomic.LoadInt64(&b.last) + pending
+}
+
+func (b *batching) Revoke(hist int64, delta int64) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := b.c.Revoke(hist, delta)
+	atomic.StoreInt64(&b.last, count)
+	return count + atomic.LoadInt64(&b.pending)
+}
+
+func (b *batching) Radvance(now, hist int64, delta int64) int64 {
+	b.Revoke(hist, delta)
+	return b.Advance(now, delta)
+}
+
+func (b *batching) Zero() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	atomic.StoreInt64(&b.pending, 0)
+	b.c.Zero()
+	atomic.StoreInt64(&b.last, 0)
+}
+
+func (b *batching) Duration() int64 {
+	return b.c.Duration()
+}
+
+type debounced struct {
+	c           Counter
+	minInterval int64
+
+	mu      sync.Mutex
+	at      int64
+	pending int64
+	buffer  bool
+	last    int64
+	closed  bool
+}
+
+// Debounced wraps c so that the advances within minInterval of the first
+// buffered one are summed, and applied to c with a single Advance at that
+// first moment when a later moment comes, or on Flush.
+//
+// The counts it returns are the last flushed count plus the buffered
+// deltas, their expiry lags behind by up to minInterval plus the time
+// since the previous advance. Revoke, Radvance and Zero flush first.
+func Debounced(c Counter, minInterval int64) Counter {
+	return &debounced{c: c, minInterval: minInterval}
+}
+
+func (d *debounced) flush() {
+	if d.buffer {
+		d.last = d.c.Advance(d.at, d.pending)
+		d.pending, d.buffer = 0, false
+	}
+}
+
+func (d *debounced) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flush()
+}
+
+func (d *debounced) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flush()
+	d.closed = true
+}
+
+func (d *debounced) Advance(now int64, delta int64) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return d.c.Advance(now, delta)
+	}
+	if d.buffer && now-d.at < d.minInterval {
+		d.pending += delta
+		return d.last + d.pending
+	}
+	d.flush()
+	d.at, d.pending, d.buffer = now, delta, true
+	return d.last + d.pending
+}
+
+func (d *debounced) Revoke(hist int64, delta int64) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flush()
+	d.last = d.c.Revoke(hist, delta)
+	return d.last
+}
+
+func (d *debounced) Radvance(now, hist int64, delta int64) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flush()
+	d.last = d.c.Radvance(now, hist, delta)
+	return d.last
+}
+
+func (d *debounced) Zero() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending, d.buffer = 0, false
+	d.c.Zero()
+	d.last = 0
+}
+
+func (d *debounced) Duration() int64 {
+	return d.c.Duration()
+}
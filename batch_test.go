@@ -0,0 +1,97 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchingCounter(t *testing.T) {
+	now := func() int64 { return time.Now().UnixMilli() }
+	c := NewSlidingWindow(now(), minute, 60)
+	b := NewBatchingCounter(c, time.Millisecond, now)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.Advance(0, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for c.Advance(now(), 0) != 10000 {
+		if time.Now().After(deadline) {
+			t.Log(c.Advance(now(), 0))
+			t.FailNow()
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	b = NewBatchingCounter(c, time.Hour, now)
+	b.Advance(0, 5)
+	if c.Advance(now(), 0) != 10000 {
+		t.FailNow()
+	}
+	b.(Flusher).Close()
+	if c.Advance(now(), 0) != 10005 {
+		t.FailNow()
+	}
+	if b.Advance(now(), 1) != 10006 {
+		t.FailNow()
+	}
+
+	b = NewBatchingCounter(c, 0, now)
+	b.Advance(0, 1)
+	b.(Flusher).Close()
+	if c.Advance(now(), 0) != 10007 {
+		t.FailNow()
+	}
+}
+
+func TestDebounced(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60, WithHistory(16))
+	d := Debounced(c, 1)
+
+	for i := 0; i < 100; i++ {
+		if d.Advance(now, 2) != int64(2*(i+1)) {
+			t.FailNow()
+		}
+	}
+	if len(c.(Historian).History()) != 0 {
+		t.FailNow()
+	}
+
+	if d.Advance(now+1, 1) != 201 {
+		t.FailNow()
+	}
+	ops := c.(Historian).History()
+	if len(ops) != 1 || ops[0].Now != now || ops[0].Delta != 200 {
+		t.FailNow()
+	}
+
+	d.(Flusher).Flush()
+	if c.Advance(now+1, 0) != 201 || len(c.(Historian).History()) != 3 {
+		t.FailNow()
+	}
+
+	d = Debounced(c, second)
+	d.Advance(now+2, 1)
+	d.Advance(now+second, 1)
+	if d.Revoke(now, 50) != 153 {
+		t.FailNow()
+	}
+	d.(Flusher).Close()
+	if d.Advance(now+second+1, 1) != 154 {
+		t.FailNow()
+	}
+}
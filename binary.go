@@ -0,0 +1,92 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The binary form is a version byte followed by the varints start, end
+// and step, the uvarint number of deltas and the varint deltas.
+const binaryVersion = 1
+
+// ErrBinaryVersion is returned by LoadFrom for an unknown binary form.
+var ErrBinaryVersion = errors.New("counter: unknown binary version")
+
+// Streamer can checkpoint its state without materializing the deltas.
+type Streamer interface {
+	// DumpTo advances to now and writes the binary form of a Dump to w.
+	// The lock is only held to copy the slots.
+	DumpTo(w io.Writer, now int64) error
+	// LoadFrom reads the binary form written by DumpTo and loads it.
+	LoadFrom(r io.Reader) error
+}
+
+func (c *slidingWindow[L, PL]) DumpTo(w io.Writer, now int64) error {
+	r := c.copyRing(now, true)
+	defer ringPool.Put(r)
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, binary.MaxVarintLen64)
+	bw.WriteByte(binaryVersion)
+	bw.Write(binary.AppendVarint(buf, r.start+r.begin*r.step))
+	bw.Write(binary.AppendVarint(buf, r.end))
+	bw.Write(binary.AppendVarint(buf, r.step))
+	bw.Write(binary.AppendUvarint(buf, uint64(r.current-r.begin+1)))
+	for i := r.begin; i <= r.current; i++ {
+		bw.Write(binary.AppendVarint(buf, r.at(i)))
+	}
+	return bw.Flush()
+}
+
+func (c *slidingWindow[L, PL]) LoadFrom(r io.Reader) error {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	version, err := br.ReadByte()
+	if err != nil {
+		return binaryError(err)
+	}
+	if version != binaryVersion {
+		return ErrBinaryVersion
+	}
+
+	var header [3]int64
+	for i := range header {
+		if header[i], err = binary.ReadVarint(br); err != nil {
+			return binaryError(err)
+		}
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return binaryError(err)
+	}
+
+	// n is not trusted for preallocation.
+	var deltas []int64
+	for i := uint64(0); i < n; i++ {
+		delta, err := binary.ReadVarint(br)
+		if err != nil {
+			return binaryError(err)
+		}
+		deltas = append(deltas, delta)
+	}
+
+	c.Load(header[0], header[1], header[2], deltas)
+	return nil
+}
+
+func binaryError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("counter: binary: %w", err)
+}
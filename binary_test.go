@@ -0,0 +1,44 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDumpTo(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, 10*minute, 36000)
+	for i := 0; i < 50000; i++ {
+		c.Advance(now, int64(i%7))
+		now += second / 50
+	}
+
+	var buf bytes.Buffer
+	if err := c.(Streamer).DumpTo(&buf, now); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	t.Log(len(data))
+
+	c2 := NewSlidingWindow(now, 10*minute, 36000)
+	if err := c2.(Streamer).LoadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Advance(now, 0) != c2.Advance(now, 0) {
+		t.FailNow()
+	}
+
+	if err := c2.(Streamer).LoadFrom(bytes.NewReader(data[:len(data)/2])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal(err)
+	}
+	if err := c2.(Streamer).LoadFrom(bytes.NewReader([]byte{9})); err != ErrBinaryVersion {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type cached struct {
+	c   Counter
+	ttl int64
+	now func() int64
+
+	peek atomic.Pointer[peekEntry]
+	dump atomic.Pointer[dumpEntry]
+}
+
+type peekEntry struct {
+	at, count, dur int64
+}
+
+type dumpEntry struct {
+	at               int64
+	start, end, step int64
+	deltas           []int64
+}
+
+// Cached wraps c so that reads are memoized for up to ttl and served
+// without locking, now reports the time in milliseconds.
+//
+// The reads are Advance with a zero delta, Duration and Dump, they may be
+// stale by up to ttl. The writes go straight to c, and do not invalidate
+// the memoized reads. The deltas returned by Dump are shared and must not
+// be modified. If c is not a Dumper, Dump returns zero values.
+func Cached(c Counter, ttl time.Duration, now func() int64) Counter {
+	return &cached{c: c, ttl: ttl.Milliseconds(), now: now}
+}
+
+func (c *cached) fresh(at int64) bool {
+	return c.now()-at < c.ttl
+}
+
+func (c *cached) peeked(now int64) *peekEntry {
+	if e := c.peek.Load(); e != nil && c.fresh(e.at) {
+		return e
+	}
+	e := &peekEntry{at: c.now()}
+	e.count = c.c.Advance(now, 0)
+	e.dur = c.c.Duration()
+	c.peek.Store(e)
+	return e
+}
+
+func (c *cached) Advance(now int64, delta int64) int64 {
+	if delta == 0 {
+		return c.peeked(now).count
+	}
+	return c.c.Advance(now, delta)
+}
+
+func (c *cached) Revoke(hist int64, delta int64) int64 {
+	return c.c.Revoke(hist, delta)
+}
+
+func (c *cached) Radvance(now, hist int64, delta int64) int64 {
+	return c.c.Radvance(now, hist, delta)
+}
+
+func (c *cached) Zero() {
+	c.c.Zero()
+}
+
+func (c *cached) Duration() int64 {
+	if e := c.peek.Load(); e != nil && c.fresh(e.at) {
+		return e.dur
+	}
+	return c.c.Duration()
+}
+
+func (c *cached) Dump() (start, end int64, step int64, deltas []int64) {
+	e := c.dump.Load()
+	if e == nil || !c.fresh(e.at) {
+		d, ok := c.c.(Dumper)
+		if !ok {
+			return
+		}
+		e = &dumpEntry{at: c.now()}
+		e.start, e.end, e.step, e.deltas = d.Dump()
+		c.dump.Store(e)
+	}
+	return e.start, e.end, e.step, e.deltas
+}
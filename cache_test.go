@@ -0,0 +1,46 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	var clock int64 = time.Now().UnixMilli()
+	now := func() int64 { return atomic.LoadInt64(&clock) }
+
+	c := NewSlidingWindow(now(), minute, 60)
+	cc := Cached(c, time.Second, now)
+
+	cc.Advance(now(), 10)
+	if cc.Advance(now(), 0) != 10 {
+		t.FailNow()
+	}
+	_, _, _, deltas := cc.(Dumper).Dump()
+
+	// Within ttl the reads do not change.
+	atomic.AddInt64(&clock, second/2)
+	if cc.Advance(now(), 5) != 15 {
+		t.FailNow()
+	}
+	if cc.Advance(now(), 0) != 10 {
+		t.FailNow()
+	}
+	if _, _, _, d := cc.(Dumper).Dump(); len(d) != len(deltas) || d[0] != 10 {
+		t.FailNow()
+	}
+
+	// They refresh after it.
+	atomic.AddInt64(&clock, second)
+	if cc.Advance(now(), 0) != 15 {
+		t.FailNow()
+	}
+	if _, _, _, d := cc.(Dumper).Dump(); d[0] != 15 {
+		t.FailNow()
+	}
+}
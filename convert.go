@@ -0,0 +1,64 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrUnsupported is returned by the conversions for the counters they
+// cannot convert.
+var ErrUnsupported = errors.New("counter: unsupported counter type")
+
+// ToSlidingWindow creates a sliding window whose count equals the count of
+// acc, placed in the most recent slot. acc must be created by
+// NewAccumulator, else ErrUnsupported is returned. An advance of acc
+// concurrent with the conversion may be only partly seen.
+func ToSlidingWindow(acc Counter, window int64, slots int) (Counter, error) {
+	a, ok := acc.(*accumulator)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	c := newSlidingWindow[sync.Mutex](a.start, window, slots)
+	c.move(atomic.LoadInt64(&a.now), atomic.LoadInt64(&a.count))
+	return c, nil
+}
+
+// ToAccumulator creates an accumulator that keeps the current count and
+// duration of c, dropping the window semantics. c must be an accumulator
+// or a sliding window of this package, else ErrUnsupported is returned.
+func ToAccumulator(c Counter) (Counter, error) {
+	switch c := c.(type) {
+	case *accumulator:
+		return &accumulator{
+			start: c.start,
+			now:   atomic.LoadInt64(&c.now),
+			count: atomic.LoadInt64(&c.count),
+		}, nil
+	case interface{ toAccumulator() *accumulator }:
+		return c.toAccumulator(), nil
+	}
+	return nil, ErrUnsupported
+}
+
+func (c *slidingWindow[L, PL]) toAccumulator() *accumulator {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return &accumulator{start: c.now - c.duration(), now: c.now, count: c.calculate()}
+}
+
+func (c *slidingWithTotal) toAccumulator() *accumulator {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.w.toAccumulator()
+}
+
+func (c *percentileWindow) toAccumulator() *accumulator {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.w.toAccumulator()
+}
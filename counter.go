@@ -6,7 +6,10 @@
 package counter
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 )
@@ -39,7 +42,7 @@ func (c *accumulator) Zero() {
 }
 
 func (c *accumulator) Advance(now int64, delta int64) int64 {
-	c.now = now
+	atomic.StoreInt64(&c.now, now)
 	return atomic.AddInt64(&c.count, delta)
 }
 
@@ -48,14 +51,32 @@ func (c *accumulator) Revoke(hist int64, delta int64) int64 {
 }
 
 func (c *accumulator) Radvance(now, hist int64, delta int64) int64 {
-	c.now = now
-	return c.count
+	atomic.StoreInt64(&c.now, now)
+	return atomic.LoadInt64(&c.count)
 }
 
 func (c *accumulator) Duration() int64 {
-	return c.now - c.start
+	return atomic.LoadInt64(&c.now) - c.start
+}
+
+// Integrator can compute the area under the count curve.
+type Integrator interface {
+	// Integral advances to now and returns the time integral of the
+	// counted units over the duration, e.g. connection-milliseconds when
+	// the deltas are connections accounted per slot.
+	Integral(now int64) int64
+}
+
+// Integral approximates the level by the current count for the whole
+// duration.
+func (c *accumulator) Integral(now int64) int64 {
+	return c.Advance(now, 0) * c.Duration()
 }
 
+// slidingWindow keeps one slot more than asked, the guard slot. It holds
+// the oldest deltas, which calculate expires in proportion to how far the
+// current slot has elapsed, so the count slides smoothly instead of
+// dropping a whole slot at each boundary.
 type slidingWindow[L any, PL locker[L]] struct {
 	l     L
 	start int64
@@ -63,74 +84,347 @@ type slidingWindow[L any, PL locker[L]] struct {
 	slots []int64
 	count int64
 	now   int64
+	opts  options
+
+	frozen  bool
+	hist    *history
+	dropped int64
+
+	// moments of the first and the last non-zero advances
+	first, last int64
+	active      bool
+
+	debt    int64
+	clamped int64
+	// the error of the guard that clamped the current advance
+	clamp error
+	// the last moment refused by the max jump guard, see check
+	jumpTo  int64
+	jumping bool
+
+	// mask is len(slots)-1 when len(slots) is a power of two, else 0.
+	mask int64
+
+	// A physical slot holds a value only if its generation is gen, so
+	// that clearing the ring is a matter of bumping gen.
+	gens []uint32
+	gen  uint32
+
+	// sum of the squared slots, kept by NewVarianceWindow only
+	sumsq float64
 }
 
-func NewSlidingWindow(start, window int64, slots int) Counter {
-	return newSlidingWindow[sync.Mutex](start, window, slots)
+func NewSlidingWindow(start, window int64, slots int, opts ...Option) Counter {
+	return newSlidingWindow[sync.Mutex](start, window, slots, opts...)
 }
 
-func NewSlidingWindowNoLock(start, window int64, slots int) Counter {
-	return newSlidingWindow[nopLocker](start, window, slots)
+func NewSlidingWindowNoLock(start, window int64, slots int, opts ...Option) Counter {
+	return newSlidingWindow[nopLocker](start, window, slots, opts...)
+}
+
+// NewSlidingWindowSpin is like NewSlidingWindow, but with a spinlock,
+// for very short critical sections advanced from many cores.
+func NewSlidingWindowSpin(start, window int64, slots int, opts ...Option) Counter {
+	return newSlidingWindow[spinLocker](start, window, slots, opts...)
+}
+
+// NewSlidingWindowStats is like NewSlidingWindow, but measures the lock
+// contention, see LockStater.
+func NewSlidingWindowStats(start, window int64, slots int, opts ...Option) Counter {
+	return newSlidingWindow[statsLocker](start, window, slots, opts...)
+}
+
+// LockStater reports the contention on the lock of a window created by
+// NewSlidingWindowStats, other windows report zeros.
+type LockStater interface {
+	LockStats() (acquires int64, waitNanos int64)
+}
+
+func (c *slidingWindow[L, PL]) LockStats() (acquires int64, waitNanos int64) {
+	if l, ok := any(&c.l).(*statsLocker); ok {
+		return atomic.LoadInt64(&l.acquires), atomic.LoadInt64(&l.waitNanos)
+	}
+	return 0, 0
+}
+
+// NewSlidingWindowAligned is like NewSlidingWindow, but rounds start down
+// to a multiple of the slot width, so windows of the same geometry share
+// slot boundaries.
+func NewSlidingWindowAligned(start, window int64, slots int, opts ...Option) Counter {
+	step := window / int64(slots)
+	aligned := start - start%step
+	if aligned > start {
+		aligned -= step
+	}
+	return newSlidingWindow[sync.Mutex](aligned, window, slots, opts...)
 }
 
-func newSlidingWindow[L any, PL locker[L]](start, window int64, slots int) *slidingWindow[L, PL] {
+func newSlidingWindow[L any, PL locker[L]](start, window int64, slots int, opts ...Option) *slidingWindow[L, PL] {
+	o := newOptions(opts)
 	return &slidingWindow[L, PL]{
 		start: start,
 		step:  window / int64(slots),
 		slots: make([]int64, slots+1),
 		count: 0,
 		now:   start,
+		opts:  o,
+		hist:  newHistory(o.history),
+		mask:  ringMask(slots + 1),
+		gens:  make([]uint32, slots+1),
+	}
+}
+
+// ringMask returns n-1 if n is a power of two, else 0.
+func ringMask(n int) int64 {
+	if n&(n-1) == 0 {
+		return int64(n - 1)
+	}
+	return 0
+}
+
+// idx maps the slot index i to the physical slot, with a bitmask instead
+// of a division when the ring size allows it. i is never negative.
+func (c *slidingWindow[L, PL]) idx(i int64) int64 {
+	if c.mask != 0 {
+		return i & c.mask
+	}
+	return i % int64(len(c.slots))
+}
+
+// get returns the value of the slot index i.
+func (c *slidingWindow[L, PL]) get(i int64) int64 {
+	p := c.idx(i)
+	if c.gens[p] != c.gen {
+		return 0
+	}
+	return c.slots[p]
+}
+
+func (c *slidingWindow[L, PL]) set(i int64, v int64) {
+	p := c.idx(i)
+	if c.opts.variance {
+		old := float64(c.get(i))
+		c.sumsq += float64(v)*float64(v) - old*old
+	}
+	c.slots[p] = v
+	c.gens[p] = c.gen
+}
+
+// clear zeroes all the slots in O(1), but once every 2^32 calls when gen
+// wraps around and the stale generations must be forgotten.
+func (c *slidingWindow[L, PL]) clear() {
+	c.gen++
+	c.sumsq = 0
+	if c.gen == 0 {
+		for i := range c.slots {
+			c.slots[i] = 0
+			c.gens[i] = 0
+		}
 	}
 }
 
 func (c *slidingWindow[L, PL]) reset(start int64) {
 	c.start = start
-	for i := 0; i < len(c.slots); i++ {
-		c.slots[i] = 0
-	}
+	c.clear()
 	c.count = 0
 	c.now = start
+	c.active = false
+	c.debt = 0
+	c.jumping = false
 }
 
 func (c *slidingWindow[L, PL]) Zero() {
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
+	if c.frozen {
+		return
+	}
+	c.record(OpZero, c.now, 0, 0)
 	now := c.now
 	c.reset(c.start)
 	c.now = now
 }
 
-func (c *slidingWindow[L, PL]) Advance(now int64, delta int64) int64 {
+func (c *slidingWindow[L, PL]) Advance(now int64, delta int64) (count int64) {
+	var applied bool
+	defer c.emit(OpAdvance, now, 0, delta, &count, &applied)
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
+	applied = c.record(OpAdvance, now, 0, delta)
 	c.advance(now, delta)
 	return c.calculate()
 }
 
-func (c *slidingWindow[L, PL]) Revoke(hist int64, delta int64) int64 {
+// TryAdvancer can give up an update instead of waiting for the lock.
+type TryAdvancer interface {
+	// TryAdvance is like Advance, but returns ok false without blocking
+	// and without advancing if the lock is held.
+	TryAdvance(now int64, delta int64) (count int64, ok bool)
+}
+
+func (c *slidingWindow[L, PL]) TryAdvance(now int64, delta int64) (count int64, ok bool) {
+	if !PL(&c.l).TryLock() {
+		return 0, false
+	}
+	var applied bool
+	defer c.emit(OpAdvance, now, 0, delta, &count, &applied)
+	defer PL(&c.l).Unlock()
+	applied = c.record(OpAdvance, now, 0, delta)
+	c.advance(now, delta)
+	return c.calculate(), true
+}
+
+// AdvancerEx can tell whether an advance moved the window.
+type AdvancerEx interface {
+	// AdvanceEx is like Advance, but also reports whether the window
+	// slid to a new slot, which changes the set of expiring deltas.
+	AdvanceEx(now int64, delta int64) (count int64, slid bool)
+}
+
+func (c *slidingWindow[L, PL]) AdvanceEx(now int64, delta int64) (count int64, slid bool) {
+	var applied bool
+	defer c.emit(OpAdvance, now, 0, delta, &count, &applied)
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
-	c.revoke(hist, delta)
-	return c.calculate()
+	applied = c.record(OpAdvance, now, 0, delta)
+	slid, _ = c.advance(now, delta)
+	return c.calculate(), slid
+}
+
+// ErrMaxJump is returned when an advance jumps further than WithMaxJump
+// allows.
+var ErrMaxJump = errors.New("counter: time jumps too far")
+
+// ErrBackwardTime is returned when an advance goes back in time under
+// WithStrictTime.
+var ErrBackwardTime = errors.New("counter: time goes backward")
+
+// ErrSlotCapped is returned when an advance is clamped by WithSlotCap.
+var ErrSlotCapped = errors.New("counter: slot cap reached")
+
+// ErrOverflow is returned when an advance is saturated by WithSaturation.
+var ErrOverflow = errors.New("counter: count overflows")
+
+// CheckedCounter reports the updates refused or clamped by its guards.
+type CheckedCounter interface {
+	Counter
+	// AdvanceE is like Advance, but returns the error of the guard that
+	// refused the update, ErrMaxJump or ErrBackwardTime, or that applied
+	// it only partially, ErrSlotCapped or ErrOverflow.
+	AdvanceE(now int64, delta int64) (count int64, err error)
+}
+
+func (c *slidingWindow[L, PL]) AdvanceE(now int64, delta int64) (count int64, err error) {
+	var applied bool
+	defer c.emit(OpAdvance, now, 0, delta, &count, &applied)
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	applied = c.record(OpAdvance, now, 0, delta)
+	_, err = c.advance(now, delta)
+	return c.calculate(), err
 }
 
-func (c *slidingWindow[L, PL]) Radvance(now, hist int64, delta int64) int64 {
+func (c *slidingWindow[L, PL]) Revoke(hist int64, delta int64) (count int64) {
+	var applied bool
+	defer c.emit(OpRevoke, 0, hist, delta, &count, &applied)
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
+	applied = c.record(OpRevoke, 0, hist, delta)
 	c.revoke(hist, delta)
-	c.advance(now, delta)
 	return c.calculate()
 }
 
+func (c *slidingWindow[L, PL]) Radvance(now, hist int64, delta int64) (count int64) {
+	var applied bool
+	defer c.emit(OpRadvance, now, hist, delta, &count, &applied)
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	applied = !c.frozen
+	count, _, _ = c.radvance(now, hist, delta)
+	return count
+}
+
+// radvance is Radvance under the lock, a refused advance refuses the
+// revoke too, the delta is not moved. It returns how much the revoke
+// took back, see revoke.
+func (c *slidingWindow[L, PL]) radvance(now, hist int64, delta int64) (count, removed int64, err error) {
+	c.record(OpRadvance, now, hist, delta)
+	if err := c.check(now, true); err != nil {
+		return c.calculate(), 0, err
+	}
+	removed = c.revoke(hist, delta)
+	c.clamp = nil
+	c.move(now, delta)
+	return c.calculate(), removed, c.clamp
+}
+
 func (c *slidingWindow[L, PL]) Duration() int64 {
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
 	return c.duration()
 }
 
-func (c *slidingWindow[L, PL]) advance(now int64, delta int64) {
-	if delta == 0 && now <= c.now {
-		return
+// advance moves to now and adds delta, unless a guard refuses it.
+func (c *slidingWindow[L, PL]) advance(now int64, delta int64) (slid bool, err error) {
+	if err = c.check(now, true); err != nil {
+		return false, err
+	}
+	c.clamp = nil
+	slid = c.move(now, delta)
+	return slid, c.clamp
+}
+
+// peek moves to now for a read, under the same guards as advance. A read
+// neither arms nor confirms a jump, only the updates do.
+func (c *slidingWindow[L, PL]) peek(now int64) {
+	if c.check(now, false) == nil {
+		c.move(now, 0)
+	}
+}
+
+// check returns the error of the guard refusing to move to now.
+//
+// A jump is accepted once it is confirmed, that is when it comes right
+// after a refused one landing at most maxJump slots before it. So an
+// isolated bogus moment is refused, but the window does not get stuck in
+// the past after an idle time longer than maxJump slots. Unless arm is
+// set the jump state is left alone.
+func (c *slidingWindow[L, PL]) check(now int64, arm bool) error {
+	if c.opts.strictTime && now < c.now {
+		return ErrBackwardTime
+	}
+	if c.opts.maxJump > 0 {
+		current := (c.now - c.start) / c.step
+		if current < 0 {
+			current = 0
+		}
+		next := (now - c.start) / c.step
+		if next-current <= c.opts.maxJump {
+			if arm {
+				c.jumping = false
+			}
+			return nil
+		}
+		if !arm {
+			return ErrMaxJump
+		}
+		refused := c.jumping
+		c.jumping = false
+		if refused && now >= c.jumpTo && next-(c.jumpTo-c.start)/c.step <= c.opts.maxJump {
+			return nil
+		}
+		c.jumping, c.jumpTo = true, now
+		return ErrMaxJump
+	}
+	return nil
+}
+
+// move with a zero delta is a pure time advance, it only expires slots
+// and moves now. It still needs the lock, because both change the state
+// calculate depends on.
+func (c *slidingWindow[L, PL]) move(now int64, delta int64) (slid bool) {
+	if c.frozen || delta == 0 && now <= c.now {
+		return false
 	}
 
 	C := int64(len(c.slots))
@@ -145,62 +439,157 @@ func (c *slidingWindow[L, PL]) advance(now int64, delta int64) {
 
 	// fast path
 	if next == current {
-		c.slots[next%C] += delta
-		c.count += delta
 		if now > c.now {
 			c.now = now
 		}
-		return
+		c.put(next, delta)
+		return false
 	}
 
 	// quick reset
 	if next-current >= C {
-		for i := int64(0); i < C; i++ {
-			c.slots[i] = 0
-		}
-		c.slots[next%C] = delta
-		c.count = delta
+		c.clear()
+		c.count = 0
 		c.now = now
-		return
+		c.put(next, delta)
+		return true
 	}
 
 	// other
 	for i := current + 1; i <= next; i++ {
-		c.count -= c.slots[i%C]
-		c.slots[i%C] = 0
+		c.count -= c.get(i)
+		c.set(i, 0)
 	}
-	c.slots[next%C] += delta
-	c.count += delta
 	c.now = now
+	c.put(next, delta)
+	return true
 }
 
-func (c *slidingWindow[L, PL]) revoke(hist int64, delta int64) {
+// put adds delta at now, to the current slot i.
+func (c *slidingWindow[L, PL]) put(i int64, delta int64) {
+	if c.opts.interpolate && i > 0 {
+		back := c.back(c.now, delta)
+		c.add(i-1, back)
+		delta -= back
+	}
+	c.add(i, delta)
+}
+
+// back returns the part of delta at moment t that interpolation puts in
+// the slot before the one of t.
+func (c *slidingWindow[L, PL]) back(t int64, delta int64) int64 {
+	f := float64((t-c.start)%c.step) / float64(c.step)
+	return int64(float64(delta) * (1 - f))
+}
+
+// add adds delta to the live slot i.
+func (c *slidingWindow[L, PL]) add(i int64, delta int64) {
+	if c.debt > 0 && delta > 0 {
+		pay := delta
+		if pay > c.debt {
+			pay = c.debt
+		}
+		c.debt -= pay
+		delta -= pay
+	}
+	if max := c.opts.slotCap; max > 0 && delta > 0 {
+		room := max - c.get(i)
+		if room < 0 {
+			room = 0
+		}
+		if delta > room {
+			c.clamped += delta - room
+			delta = room
+			c.clamp = ErrSlotCapped
+		}
+	}
+	if c.opts.saturate {
+		d := saturate(saturate(delta, c.count), c.get(i))
+		if d != delta {
+			delta = d
+			c.clamp = ErrOverflow
+		}
+	}
+	if delta == 0 {
+		return
+	}
+
+	c.set(i, c.get(i)+delta)
+	c.count += delta
+
+	if begin, _ := c.live(); !c.active || (c.first-c.start)/c.step < begin {
+		c.first = c.now
+	}
+	c.last = c.now
+	c.active = true
+}
+
+// saturate returns the part of delta that can be added to x without
+// overflowing.
+func saturate(delta, x int64) int64 {
+	if delta > 0 && x > math.MaxInt64-delta {
+		return math.MaxInt64 - x
+	}
+	if delta < 0 && x < math.MinInt64-delta {
+		return math.MinInt64 - x
+	}
+	return delta
+}
+
+// revoke returns how much it took back, from the slots or as a debt.
+func (c *slidingWindow[L, PL]) revoke(hist int64, delta int64) (removed int64) {
+	if c.frozen {
+		return 0
+	}
+
+	prev := (hist - c.start) / c.step
+	if c.opts.interpolate && prev > 0 {
+		back := c.back(hist, delta)
+		removed += c.revokeSlot(prev-1, back)
+		delta -= back
+	}
+	return removed + c.revokeSlot(prev, delta)
+}
+
+func (c *slidingWindow[L, PL]) revokeSlot(prev int64, delta int64) (removed int64) {
 	C := int64(len(c.slots))
 	current := (c.now - c.start) / c.step
 	if current < 0 {
 		current = 0
 	}
-	prev := (hist - c.start) / c.step
 
 	if prev >= 0 && current-prev >= 0 && current-prev < C {
 		reduce := delta
-		if reduce > c.slots[prev%C] {
-			reduce = c.slots[prev%C]
+		if v := c.get(prev); reduce > v {
+			reduce = v
 		}
-		c.slots[prev%C] -= reduce
+		c.set(prev, c.get(prev)-reduce)
 		c.count -= reduce
+		removed = reduce
+		if c.opts.revokeDebt && reduce < delta {
+			c.debt += delta - reduce
+			removed = delta
+		}
+	} else if c.opts.revokeDebt && prev > current && delta > 0 {
+		// revoked before being advanced
+		c.debt += delta
+		removed = delta
 	}
+	return removed
 }
 
+// calculate never returns a negative count.
 func (c *slidingWindow[L, PL]) calculate() int64 {
-	C := int64(len(c.slots))
-	current := (c.now - c.start) / c.step
-	if current < 0 {
-		return c.count
+	count := c.count
+	if current := (c.now - c.start) / c.step; current >= 0 {
+		expired := c.get(current + 1)
+		percent := float64((c.now-c.start)%c.step) / float64(c.step)
+		count -= c.opts.rounding.round(float64(expired) * percent)
+	}
+	if count < 0 {
+		count = 0
 	}
-	expired := c.slots[(current+1)%C]
-	percent := float64((c.now-c.start)%c.step) / float64(c.step)
-	return c.count - int64(float64(expired)*percent)
+	return count
 }
 
 func (c *slidingWindow[L, PL]) duration() int64 {
@@ -212,67 +601,751 @@ func (c *slidingWindow[L, PL]) duration() int64 {
 	return dur
 }
 
-type Dumper interface {
-	Dump() (start, end int64, step int64, deltas []int64)
+// ErrCorrupt is wrapped by the errors of Validate.
+var ErrCorrupt = errors.New("counter: corrupted state")
+
+// Validator can check its internal invariants.
+type Validator interface {
+	// Validate returns a descriptive error wrapping ErrCorrupt if the
+	// state of the counter is inconsistent.
+	Validate() error
 }
 
-func (c *slidingWindow[L, PL]) Dump() (start, end int64, step int64, deltas []int64) {
+func (c *slidingWindow[L, PL]) Validate() error {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+
+	if c.step <= 0 {
+		return fmt.Errorf("%w: step %d is not positive", ErrCorrupt, c.step)
+	}
+	if len(c.slots) < 2 {
+		return fmt.Errorf("%w: %d physical slots", ErrCorrupt, len(c.slots))
+	}
+	if c.now < c.start {
+		return fmt.Errorf("%w: now %d is before start %d", ErrCorrupt, c.now, c.start)
+	}
+	if c.debt < 0 {
+		return fmt.Errorf("%w: negative debt %d", ErrCorrupt, c.debt)
+	}
+	var sum int64
+	for i, v := range c.slots {
+		if c.gens[i] == c.gen {
+			sum += v
+		}
+	}
+	if sum != c.count {
+		return fmt.Errorf("%w: count %d does not match the slot sum %d", ErrCorrupt, c.count, sum)
+	}
+	return nil
+}
+
+// ErrSlotIndex is returned by SetSlot for an index out of range.
+var ErrSlotIndex = errors.New("counter: slot index out of range")
+
+// RawAccessor writes the state directly, bypassing the timestamp math and
+// the options. It is meant for restore and migration tools only.
+type RawAccessor interface {
+	// SetSlot sets the physical slot index, in [0, PhysicalSlots), to
+	// value and keeps the count equal to the slot sum. The slot of a
+	// moment t is (t-start)/Resolution modulo PhysicalSlots.
+	SetSlot(index int, value int64) error
+	// SetNow sets now without expiring any slot.
+	SetNow(now int64)
+}
+
+func (c *slidingWindow[L, PL]) SetSlot(index int, value int64) error {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	if index < 0 || index >= len(c.slots) {
+		return ErrSlotIndex
+	}
+	if c.frozen {
+		return nil
+	}
+	c.count += value - c.get(int64(index))
+	c.set(int64(index), value)
+	return nil
+}
+
+func (c *slidingWindow[L, PL]) SetNow(now int64) {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	if c.frozen {
+		return
+	}
+	c.now = now
+}
+
+// Freezer can make a counter read-only.
+type Freezer interface {
+	// Freeze makes all the mutations no-ops until Unfreeze, reads keep
+	// working on the frozen state.
+	Freeze()
+	Unfreeze()
+	Frozen() bool
+}
+
+func (c *slidingWindow[L, PL]) Freeze() {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.frozen = true
+}
+
+func (c *slidingWindow[L, PL]) Unfreeze() {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.frozen = false
+}
+
+func (c *slidingWindow[L, PL]) Frozen() bool {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return c.frozen
+}
+
+// LockedCloner can copy a window into one safe for concurrent use.
+type LockedCloner interface {
+	// CloneLocked returns a copy of the state and the options, backed by
+	// a sync.Mutex whatever the locker of the source is.
+	CloneLocked() Counter
+}
+
+func (c *slidingWindow[L, PL]) CloneLocked() Counter {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+
+	n := &slidingWindow[sync.Mutex, *sync.Mutex]{
+		start:   c.start,
+		step:    c.step,
+		slots:   append([]int64(nil), c.slots...),
+		gens:    append([]uint32(nil), c.gens...),
+		gen:     c.gen,
+		sumsq:   c.sumsq,
+		count:   c.count,
+		now:     c.now,
+		opts:    c.opts,
+		frozen:  c.frozen,
+		first:   c.first,
+		last:    c.last,
+		active:  c.active,
+		debt:    c.debt,
+		clamped: c.clamped,
+		mask:    c.mask,
+	}
+	n.opts.labels = copyLabels(c.opts.labels)
+	if c.hist != nil {
+		h := *c.hist
+		h.ops = append([]Op(nil), c.hist.ops...)
+		n.hist = &h
+	}
+	return n
+}
+
+// Debtor is a counter in revoke debt mode, see WithRevokeDebt.
+type Debtor interface {
+	// Debt returns the revoked amount not yet paid off by advances.
+	Debt() int64
+}
+
+func (c *slidingWindow[L, PL]) Debt() int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return c.debt
+}
+
+// SlotCapper is a counter with a slot cap, see WithSlotCap.
+type SlotCapper interface {
+	// ClampedTotal returns the sum of the advanced amounts dropped by the
+	// cap since the creation.
+	ClampedTotal() int64
+}
+
+func (c *slidingWindow[L, PL]) ClampedTotal() int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return c.clamped
+}
+
+// ActivityTracker knows when the live window was active.
+type ActivityTracker interface {
+	// FirstActive returns the moment of the earliest non-zero advance
+	// still in the window, or -1 if there is none. Once the slot of that
+	// advance expires, it is known only to the start of its slot.
+	FirstActive() int64
+	// LastActive returns the moment of the latest non-zero advance still
+	// in the window, or -1 if there is none.
+	LastActive() int64
+	// ActiveDuration advances to now and returns LastActive minus
+	// FirstActive, the span of the activity without the idle head and
+	// tail of the window, or 0 if there is none.
+	ActiveDuration(now int64) int64
+}
+
+func (c *slidingWindow[L, PL]) FirstActive() int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return c.firstActive()
+}
+
+func (c *slidingWindow[L, PL]) LastActive() int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return c.lastActive()
+}
+
+func (c *slidingWindow[L, PL]) ActiveDuration(now int64) int64 {
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
+	c.peek(now)
+	first := c.firstActive()
+	if first < 0 {
+		return 0
+	}
+	return c.lastActive() - first
+}
+
+func (c *slidingWindow[L, PL]) firstActive() int64 {
+	begin, current := c.live()
+	for i := begin; i <= current; i++ {
+		if c.get(i) == 0 {
+			continue
+		}
+		if c.active && (c.first-c.start)/c.step == i {
+			return c.first
+		}
+		return c.start + i*c.step
+	}
+	return -1
+}
+
+func (c *slidingWindow[L, PL]) lastActive() int64 {
+	begin, current := c.live()
+	for i := current; i >= begin; i-- {
+		if c.get(i) == 0 {
+			continue
+		}
+		if c.active && (c.last-c.start)/c.step == i {
+			return c.last
+		}
+		return c.start + i*c.step
+	}
+	return -1
+}
 
+// live returns the indexes of the oldest and the current live slots.
+func (c *slidingWindow[L, PL]) live() (begin, current int64) {
 	C := int64(len(c.slots))
-	current := (c.now - c.start) / c.step
+	current = (c.now - c.start) / c.step
 	if current < 0 {
 		current = 0
 	}
-
-	begin := int64(0)
 	if current >= C {
 		begin = current - (C - 1)
 	}
+	return
+}
+
+// Integral is the sum over the live slots of delta times the part of the
+// slot inside the window, that is delta*step for the full ones. It treats
+// the delta of a slot as a level held for the whole slot, so a constant
+// delta d per slot gives d*window once the window is full, within the
+// slot resolution.
+func (c *slidingWindow[L, PL]) Integral(now int64) int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.peek(now)
+
+	begin, current := c.live()
+	from := c.now - c.duration()
 
-	slots := make([]int64, 0, len(c.slots))
+	var area int64
 	for i := begin; i <= current; i++ {
-		slots = append(slots, c.slots[i%C])
+		lo, hi := c.start+i*c.step, c.start+(i+1)*c.step
+		if lo < from {
+			lo = from
+		}
+		if hi > c.now {
+			hi = c.now
+		}
+		if hi > lo {
+			area += c.get(i) * (hi - lo)
+		}
+	}
+	return area
+}
+
+// ErrInvalidFactor is returned by Scale for negative, NaN or infinite
+// factors.
+var ErrInvalidFactor = errors.New("counter: invalid scale factor")
+
+// Scaler can rescale its whole history.
+type Scaler interface {
+	// Scale multiplies every slot and the debt by factor, rounding to
+	// nearest, and keeps the window geometry. A zero factor is equivalent
+	// to Zero, the debt and the activity are cleared too.
+	Scale(factor float64) error
+}
+
+func (c *slidingWindow[L, PL]) Scale(factor float64) error {
+	if factor < 0 || math.IsNaN(factor) || math.IsInf(factor, 0) {
+		return ErrInvalidFactor
+	}
+
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	if c.frozen {
+		return nil
+	}
+	if factor == 0 {
+		now := c.now
+		c.reset(c.start)
+		c.now = now
+		return nil
+	}
+
+	c.debt = int64(math.Round(float64(c.debt) * factor))
+	c.count = 0
+	for i := range c.slots {
+		v := int64(math.Round(float64(c.get(int64(i))) * factor))
+		c.set(int64(i), v)
+		c.count += v
+	}
+	return nil
+}
+
+// Resolver reports the time granularity of a counter.
+type Resolver interface {
+	// Resolution returns the width of one slot, sub-window queries are
+	// answered at this granularity.
+	Resolution() int64
+}
+
+func (c *slidingWindow[L, PL]) Resolution() int64 {
+	return c.step
+}
+
+// CompletedCounter can leave the in-progress slot out.
+type CompletedCounter interface {
+	// CompletedCount advances to now and returns the count of the fully
+	// elapsed slots only, without the current slot.
+	CompletedCount(now int64) int64
+}
+
+func (c *slidingWindow[L, PL]) CompletedCount(now int64) int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.peek(now)
+
+	_, current := c.live()
+	count := c.calculate() - c.get(current)
+	if count < 0 {
+		count = 0
+	}
+	return count
+}
+
+// Slotter tells the logical and the physical slot counts of a window.
+type Slotter interface {
+	// LiveSlots returns the number of slots the window was created with.
+	LiveSlots() int
+	// PhysicalSlots returns LiveSlots plus the guard slot.
+	PhysicalSlots() int
+}
+
+func (c *slidingWindow[L, PL]) LiveSlots() int {
+	return len(c.slots) - 1
+}
+
+func (c *slidingWindow[L, PL]) PhysicalSlots() int {
+	return len(c.slots)
+}
+
+// SinceCounter can count a part of the window.
+type SinceCounter interface {
+	// CountSince advances to now and returns the count since the moment
+	// since, rounded down to a slot boundary. If since is older than the
+	// window, the whole window is counted.
+	CountSince(now, since int64) int64
+}
+
+func (c *slidingWindow[L, PL]) CountSince(now, since int64) int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.peek(now)
+
+	begin, current := c.live()
+	first := (since - c.start) / c.step
+	if first <= begin {
+		return c.calculate()
+	}
+
+	var count int64
+	for i := first; i <= current; i++ {
+		count += c.get(i)
 	}
+	return count
+}
+
+// Forecaster predicts the decay of a window.
+type Forecaster interface {
+	// TimeToThreshold advances to now and returns how long after now the
+	// count first drops below target if nothing is advanced anymore, 0 if
+	// it already is, or -1 if it never will.
+	TimeToThreshold(now, target int64) int64
+}
+
+func (c *slidingWindow[L, PL]) TimeToThreshold(now, target int64) int64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.peek(now)
 
-	start = c.start + begin*c.step
-	end = c.now
-	step = c.step
-	deltas = slots
+	if target <= 0 {
+		return -1
+	}
+	if c.calculate() < target {
+		return 0
+	}
+
+	// The count only decreases while the slots expire, and is zero once
+	// the current slot has left the ring.
+	_, current := c.live()
+	lo, hi := c.now, c.start+(current+int64(len(c.slots)))*c.step
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if c.countAt(mid) < target {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi - c.now
+}
+
+// countAt is what calculate would return at the future moment t, if
+// nothing is advanced until then.
+func (c *slidingWindow[L, PL]) countAt(t int64) int64 {
+	begin, current := c.live()
+	oldest := (t-c.start)/c.step - int64(len(c.slots)) + 1
+	if oldest > begin {
+		begin = oldest
+	}
+
+	var count int64
+	for i := begin; i <= current; i++ {
+		count += c.get(i)
+	}
+	if oldest >= begin && oldest <= current {
+		percent := float64((t-c.start)%c.step) / float64(c.step)
+		count -= c.opts.rounding.round(float64(c.get(oldest)) * percent)
+	}
+	if count < 0 {
+		count = 0
+	}
+	return count
+}
+
+// Classifier compares the count with several thresholds at once.
+type Classifier interface {
+	// Classify advances to now and returns the index of the highest of the
+	// thresholds the count reaches, or -1 if it is below all of them. The
+	// thresholds need not be sorted.
+	Classify(now int64, thresholds []int64) int
+}
+
+func (c *slidingWindow[L, PL]) Classify(now int64, thresholds []int64) int {
+	PL(&c.l).Lock()
+	c.peek(now)
+	count := c.calculate()
+	PL(&c.l).Unlock()
+
+	level := -1
+	for i, th := range thresholds {
+		if count >= th && (level < 0 || th > thresholds[level]) {
+			level = i
+		}
+	}
+	return level
+}
+
+// TailAdvancer can advance and peek at the most recent slots atomically.
+type TailAdvancer interface {
+	// AdvanceWithTail is like Advance, but also returns the deltas of the
+	// last k live slots in chronological order, ending with the current one.
+	AdvanceWithTail(now int64, delta int64, k int) (count int64, tail []int64)
+}
+
+func (c *slidingWindow[L, PL]) AdvanceWithTail(now int64, delta int64, k int) (count int64, tail []int64) {
+	var applied bool
+	defer c.emit(OpAdvance, now, 0, delta, &count, &applied)
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	applied = c.record(OpAdvance, now, 0, delta)
+	c.advance(now, delta)
+
+	if k < 0 {
+		k = 0
+	}
+	begin, current := c.live()
+	if from := current - int64(k) + 1; from > begin {
+		begin = from
+	}
+
+	tail = make([]int64, 0, current-begin+1)
+	for i := begin; i <= current; i++ {
+		tail = append(tail, c.get(i))
+	}
+	return c.calculate(), tail
+}
+
+// Slot is a slot of a sliding window.
+type Slot struct {
+	Start int64
+	Delta int64
+}
+
+// TopSlotter can find the busiest moments of the window.
+type TopSlotter interface {
+	// TopSlots advances to now and returns the k live slots with the
+	// highest deltas, sorted descending, ties ordered by time.
+	TopSlots(now int64, k int) []Slot
+}
+
+func (c *slidingWindow[L, PL]) TopSlots(now int64, k int) []Slot {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.peek(now)
+	if k <= 0 {
+		return []Slot{}
+	}
+
+	begin, current := c.live()
+	slots := make([]Slot, 0, current-begin+1)
+	for i := begin; i <= current; i++ {
+		slots = append(slots, Slot{c.start + i*c.step, c.get(i)})
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Delta > slots[j].Delta
+	})
+	if k < len(slots) {
+		slots = slots[:k]
+	}
+	return slots
+}
+
+// Dumper exports the live slots, oldest first. For a window of n slots
+// there are up to n+1 deltas, the first one being the partially expired
+// guard slot once the window is full.
+type Dumper interface {
+	Dump() (start, end int64, step int64, deltas []int64)
+}
+
+// ring is a copy of the slots, made under the lock so that the slow part
+// of a dump can run after the lock is released.
+type ring struct {
+	slots          []int64
+	start, end     int64
+	step           int64
+	begin, current int64
+	mask           int64
+}
+
+var ringPool sync.Pool
+
+// copyRing copies the slots, advancing to now first if advance is set.
+// The ring must be released with ringPool.Put.
+func (c *slidingWindow[L, PL]) copyRing(now int64, advance bool) *ring {
+	// The slots slice is never reallocated, its length is safe to read.
+	C := len(c.slots)
+	r, _ := ringPool.Get().(*ring)
+	if r == nil || cap(r.slots) < C {
+		r = &ring{slots: make([]int64, C)}
+	}
+	r.slots = r.slots[:C]
+
+	PL(&c.l).Lock()
+	if advance {
+		c.peek(now)
+	}
+	copy(r.slots, c.slots)
+	for i, g := range c.gens {
+		if g != c.gen {
+			r.slots[i] = 0
+		}
+	}
+	r.begin, r.current = c.live()
+	r.start, r.end, r.step = c.start, c.now, c.step
+	r.mask = c.mask
+	PL(&c.l).Unlock()
+	return r
+}
+
+func (r *ring) at(i int64) int64 {
+	if r.mask != 0 {
+		return r.slots[i&r.mask]
+	}
+	return r.slots[i%int64(len(r.slots))]
+}
+
+// Dump only copies the slots under the lock, the deltas are built after
+// the lock is released.
+func (c *slidingWindow[L, PL]) Dump() (start, end int64, step int64, deltas []int64) {
+	r := c.copyRing(0, false)
+	deltas = make([]int64, 0, r.current-r.begin+1)
+	for i := r.begin; i <= r.current; i++ {
+		deltas = append(deltas, r.at(i))
+	}
+	start, end, step = r.start+r.begin*r.step, r.end, r.step
+	ringPool.Put(r)
 	return
 }
 
+// ErrGeometry is returned when two windows do not have the same geometry.
+var ErrGeometry = errors.New("counter: mismatched window geometry")
+
+// Overlapper can measure how much of its activity coincides with another
+// window's.
+type Overlapper interface {
+	// Overlap returns the sum over the common live slots of the minimum
+	// of both deltas. The windows must have the same slot width and count
+	// and share slot boundaries.
+	Overlap(other Counter) (int64, error)
+}
+
+func (c *slidingWindow[L, PL]) Overlap(other Counter) (int64, error) {
+	o, ok := other.(interface {
+		copyRing(now int64, advance bool) *ring
+	})
+	if !ok {
+		return 0, ErrGeometry
+	}
+
+	a := c.copyRing(0, false)
+	defer ringPool.Put(a)
+	b := o.copyRing(0, false)
+	defer ringPool.Put(b)
+	if a.step != b.step || len(a.slots) != len(b.slots) || (a.start-b.start)%a.step != 0 {
+		return 0, ErrGeometry
+	}
+
+	var sum int64
+	for i := a.begin; i <= a.current; i++ {
+		j := (a.start + i*a.step - b.start) / b.step
+		if j < b.begin || j > b.current {
+			continue
+		}
+		x, y := a.at(i), b.at(j)
+		if y < x {
+			x = y
+		}
+		sum += x
+	}
+	return sum, nil
+}
+
+// Loader restores the output of a Dump.
+//
+// The work of Load is bounded by len(deltas) * min(step/Resolution, slots+1),
+// whatever the step of the dump is.
+//
+// Load holds the lock for its whole duration, so concurrent calls see the
+// state either before or after it. Afterwards now is end and, like for
+// any Advance that goes back in time, an Advance earlier than end is
+// counted in the slot of end.
 type Loader interface {
 	Load(start, end int64, step int64, deltas []int64)
 }
 
 func (c *slidingWindow[L, PL]) Load(start, end int64, step int64, deltas []int64) {
+	c.LoadReport(start, end, step, deltas)
+}
+
+// LoadReporter is a Loader that reports what did not fit.
+type LoadReporter interface {
+	// LoadReport is like Load, but returns the total of the deltas that
+	// were expired during the load because the window is too small to
+	// hold the whole history.
+	LoadReport(start, end int64, step int64, deltas []int64) (dropped int64)
+}
+
+func (c *slidingWindow[L, PL]) LoadReport(start, end int64, step int64, deltas []int64) (dropped int64) {
 	PL(&c.l).Lock()
 	defer PL(&c.l).Unlock()
+	return c.load(start, end, step, deltas)
+}
+
+func (c *slidingWindow[L, PL]) load(start, end int64, step int64, deltas []int64) (dropped int64) {
+	if c.frozen {
+		return 0
+	}
+	c.record(OpLoad, end, start, 0)
 
 	c.reset(start)
 
-	segs := int64(math.Max(math.Round(float64(step)/float64(c.step)), 1.0))
+	// The deltas are already placed, they must not be spread again.
+	interpolate := c.opts.interpolate
+	c.opts.interpolate = false
+	defer func() { c.opts.interpolate = interpolate }()
+
+	n := int64(len(deltas))
+	if step == c.step && n > 0 && n <= int64(len(c.slots)) &&
+		start+(n-1)*step <= end && end < start+n*step &&
+		c.opts.slotCap == 0 {
+		c.copySlots(end, deltas)
+		return 0
+	}
+	return c.replay(start, end, step, deltas)
+}
+
+// copySlots is the same geometry case of load, the deltas map one to one
+// to the slots of the fresh ring, end is in the last one and nothing
+// expires. It leaves the same state as replay.
+func (c *slidingWindow[L, PL]) copySlots(end int64, deltas []int64) {
+	for i, delta := range deltas {
+		c.set(int64(i), delta)
+		c.count += delta
+		if delta == 0 {
+			continue
+		}
+		if !c.active {
+			c.first = c.start + int64(i)*c.step
+		}
+		c.last = c.start + int64(i)*c.step
+		c.active = true
+	}
+	c.now = end
+}
+
+// replay advances the deltas one by one, from a fresh ring.
+func (c *slidingWindow[L, PL]) replay(start, end int64, step int64, deltas []int64) (dropped int64) {
+	// Each delta is spread over at most one full ring, so the work is
+	// bounded by len(deltas) * min(step/c.step, len(c.slots)).
+	segs := math.Round(float64(step) / float64(c.step))
+	segs = math.Max(math.Min(segs, float64(len(c.slots))), 1.0)
+
+	var total int64
 
 	for i := int64(0); i < int64(len(deltas)); i++ {
 		delta := deltas[i]
 		remain := delta
 		now := start + i*step
 
-		for j := int64(0); j < segs; j++ {
+		for j := int64(0); j < int64(segs); j++ {
 			if now >= end {
 				now = end
 				break
 			}
-			c.advance(now, delta/segs)
-			remain -= delta / segs
-			now += step / segs
+			c.move(now, delta/int64(segs))
+			remain -= delta / int64(segs)
+			now += step / int64(segs)
 		}
 
 		if now >= end {
 			now = end
 		}
-		c.advance(now, remain)
+		c.move(now, remain)
+		total += delta
 	}
+
+	return total - c.count
 }
@@ -5,6 +5,9 @@
 package counter
 
 import (
+	"errors"
+	"math"
+	"sync"
 	"testing"
 	"time"
 )
@@ -116,3 +119,1266 @@ func TestSlidingWindow(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestLoadReport(t *testing.T) {
+	now := time.Now().UnixMilli()
+
+	deltas := make([]int64, 120)
+	for i := range deltas {
+		deltas[i] = 10
+	}
+
+	c := NewSlidingWindow(now, minute, 60)
+	dropped := c.(LoadReporter).LoadReport(now, now+2*minute, second, deltas)
+	t.Log(dropped)
+	if dropped != 600 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWindow(now, 2*minute, 120)
+	dropped = c.(LoadReporter).LoadReport(now, now+2*minute, second, deltas)
+	t.Log(dropped)
+	if dropped != 0 {
+		t.FailNow()
+	}
+}
+
+func TestAdvanceWithTail(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+
+	var count int64
+	var tail []int64
+	for i := 0; i < 90; i++ {
+		count, tail = c.(TailAdvancer).AdvanceWithTail(now, int64(i), 5)
+		now += second
+	}
+	t.Log(count, tail)
+	if len(tail) != 5 || tail[4] != 89 || tail[0] != 85 {
+		t.FailNow()
+	}
+
+	_, _, _, deltas := c.(Dumper).Dump()
+	deltas = deltas[len(deltas)-5:]
+	for i := range tail {
+		if tail[i] != deltas[i] {
+			t.FailNow()
+		}
+	}
+
+	_, tail = c.(TailAdvancer).AdvanceWithTail(now, 0, 100)
+	if len(tail) != 61 {
+		t.FailNow()
+	}
+	if count, tail = c.(TailAdvancer).AdvanceWithTail(now, 1, -2); len(tail) != 0 || count == 0 {
+		t.FailNow()
+	}
+}
+
+func TestConvert(t *testing.T) {
+	now := time.Now().UnixMilli()
+	a := NewAccumulator(now)
+	for i := 0; i < 100; i++ {
+		a.Advance(now, 3)
+		now += second
+	}
+
+	c, err := ToSlidingWindow(a, minute, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := c.Advance(now-second, 0); count != 300 {
+		t.Log(count)
+		t.FailNow()
+	}
+	if c.Duration() != minute {
+		t.FailNow()
+	}
+
+	now += minute
+	c.Advance(now, 7)
+
+	if a, err = ToAccumulator(c); err != nil {
+		t.Fatal(err)
+	}
+	if count := a.Advance(now, 0); count != 7 {
+		t.Log(count)
+		t.FailNow()
+	}
+	if a.Duration() != minute {
+		t.FailNow()
+	}
+
+	if _, err := ToSlidingWindow(c, minute, 60); err != ErrUnsupported {
+		t.FailNow()
+	}
+	if _, err := ToAccumulator(NewSumCounter(c)); err != ErrUnsupported {
+		t.FailNow()
+	}
+	tc := NewSlidingWithTotal(now, minute, 60)
+	tc.Advance(now, 4)
+	if a, err = ToAccumulator(tc); err != nil || a.Advance(now, 0) != 4 {
+		t.FailNow()
+	}
+}
+
+func TestRounding(t *testing.T) {
+	var errs [3]int64
+	for _, r := range []Rounding{Trunc, Nearest, Floor} {
+		now := time.Now().UnixMilli()
+		c := NewSlidingWindow(now, minute, 60, WithRounding(r))
+
+		var events []int64
+		for i := 0; i < 6000; i++ {
+			count := c.Advance(now, 1)
+			events = append(events, now)
+			for events[0] <= now-minute {
+				events = events[1:]
+			}
+			if i >= 600 {
+				e := count - int64(len(events))
+				if e < 0 {
+					e = -e
+				}
+				errs[r] += e
+			}
+			now += 143
+		}
+	}
+	t.Log(errs)
+	if errs[Nearest] >= errs[Trunc] || errs[Floor] != errs[Trunc] {
+		t.FailNow()
+	}
+}
+
+func TestCountSince(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	if c.(Resolver).Resolution() != second {
+		t.FailNow()
+	}
+
+	for i := 0; i < 30; i++ {
+		c.Advance(now+int64(i)*second, 1)
+	}
+
+	sc := c.(SinceCounter)
+	end := now + 30*second
+	if sc.CountSince(end, end-10*second) != 10 {
+		t.FailNow()
+	}
+	// Snapped to the start of the slot.
+	if sc.CountSince(end, end-10*second+second/2) != 10 {
+		t.FailNow()
+	}
+	if sc.CountSince(end, end-10*second-second/2) != 11 {
+		t.FailNow()
+	}
+	if sc.CountSince(end, now-minute) != 30 {
+		t.FailNow()
+	}
+}
+
+func BenchmarkAdvanceConcurrentDump(b *testing.B) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 3600)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				c.(Dumper).Dump()
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Advance(now+int64(i), 1)
+	}
+	b.StopTimer()
+	close(done)
+}
+
+func BenchmarkPeek(b *testing.B) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	for i := 0; i < 60; i++ {
+		c.Advance(now, 10)
+		now += second
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Advance(now+int64(i), 0)
+	}
+}
+
+func TestTopSlots(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	for i := int64(0); i < 60; i++ {
+		delta := int64(1)
+		switch i {
+		case 10, 40:
+			delta = 50
+		case 20:
+			delta = 100
+		}
+		c.Advance(now+i*second, delta)
+	}
+
+	top := c.(TopSlotter).TopSlots(now+59*second, 3)
+	t.Log(top)
+	if len(top) != 3 ||
+		top[0] != (Slot{now + 20*second, 100}) ||
+		top[1] != (Slot{now + 10*second, 50}) ||
+		top[2] != (Slot{now + 40*second, 50}) {
+		t.FailNow()
+	}
+
+	if len(c.(TopSlotter).TopSlots(now+59*second, 100)) != 60 {
+		t.FailNow()
+	}
+	if top := c.(TopSlotter).TopSlots(now+59*second, -1); top == nil || len(top) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestAdvanceEx(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60).(AdvancerEx)
+
+	if _, slid := c.AdvanceEx(now+second/2, 1); slid {
+		t.FailNow()
+	}
+	if _, slid := c.AdvanceEx(now+second/4, 1); slid {
+		t.FailNow()
+	}
+	if count, slid := c.AdvanceEx(now+second, 1); !slid || count != 3 {
+		t.FailNow()
+	}
+	if _, slid := c.AdvanceEx(now+2*minute, 0); !slid {
+		t.FailNow()
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	c.Advance(now, 10)
+
+	f := c.(Freezer)
+	f.Freeze()
+	if !f.Frozen() {
+		t.FailNow()
+	}
+	if c.Advance(now+second, 5) != 10 || c.Revoke(now, 10) != 10 || c.Radvance(now, now, 3) != 10 {
+		t.FailNow()
+	}
+	c.Zero()
+	c.(Loader).Load(now, now, second, []int64{1})
+	if c.Advance(now, 0) != 10 || c.Duration() != 0 {
+		t.FailNow()
+	}
+
+	f.Unfreeze()
+	if c.Advance(now+second, 5) != 15 {
+		t.FailNow()
+	}
+}
+
+func TestSlidingWindowAligned(t *testing.T) {
+	now := time.Now().UnixMilli()
+	now -= now % second
+	a := NewSlidingWindowAligned(now+second/10, minute, 60)
+	b := NewSlidingWindowAligned(now+second/3, minute, 60)
+
+	a.Advance(now+5*second, 1)
+	b.Advance(now+5*second+second/2, 1)
+	startA, _, _, _ := a.(Dumper).Dump()
+	startB, _, _, _ := b.(Dumper).Dump()
+	if startA != startB || startA%second != 0 {
+		t.FailNow()
+	}
+
+	c := NewSlidingWindowAligned(-second/2, minute, 60)
+	if start, _, _, _ := c.(Dumper).Dump(); start != -second {
+		t.FailNow()
+	}
+}
+
+func TestIntegral(t *testing.T) {
+	c := NewSlidingWindow(0, 10*second, 10)
+	for i := int64(0); i < 20; i++ {
+		c.Advance(i*second, 10)
+	}
+	if area := c.(Integrator).Integral(20 * second); area != 10*10*second {
+		t.Log(area)
+		t.FailNow()
+	}
+	// The guard slot counts for its half still in the window, the current
+	// slot for its elapsed half.
+	c.Advance(20*second, 10)
+	if area := c.(Integrator).Integral(20*second + 500); area != 10*10*second {
+		t.Log(area)
+		t.FailNow()
+	}
+
+	// not full yet
+	c = NewSlidingWindow(0, 10*second, 10)
+	c.Advance(0, 3)
+	c.Advance(2*second, 4)
+	if c.(Integrator).Integral(2*second+250) != 3*second+4*250 {
+		t.FailNow()
+	}
+
+	now := time.Now().UnixMilli()
+	a := NewAccumulator(now)
+	a.Advance(now, 5)
+	if a.(Integrator).Integral(now+30*second) != 5*30*second {
+		t.FailNow()
+	}
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Now().UnixMilli()
+	if NewSlidingWindow(now, minute, 60).(Historian).History() != nil {
+		t.FailNow()
+	}
+
+	c := NewSlidingWindow(now, minute, 60, WithHistory(3))
+	c.Advance(now, 1)
+	c.Revoke(now, 1)
+	if h := c.(Historian).History(); len(h) != 2 || h[0] != (Op{OpAdvance, now, 0, 1}) {
+		t.FailNow()
+	}
+
+	c.Radvance(now+1, now, 2)
+	c.Zero()
+	h := c.(Historian).History()
+	t.Log(h)
+	if len(h) != 3 ||
+		h[0] != (Op{OpRevoke, 0, now, 1}) ||
+		h[1] != (Op{OpRadvance, now + 1, now, 2}) ||
+		h[2] != (Op{OpZero, now + 1, 0, 0}) {
+		t.FailNow()
+	}
+}
+
+func TestScale(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	for i := 0; i < 90; i++ {
+		c.Advance(now, 1000+int64(i))
+		now += second
+	}
+	before := c.Advance(now, 0)
+
+	s := c.(Scaler)
+	if s.Scale(-1) != ErrInvalidFactor || s.Scale(math.NaN()) != ErrInvalidFactor {
+		t.FailNow()
+	}
+	if err := s.Scale(0.001); err != nil {
+		t.FailNow()
+	}
+	after := c.Advance(now, 0)
+	t.Log(before, after)
+	// Each slot is rounded on its own.
+	if after < before/1000-31 || after > before/1000+31 {
+		t.FailNow()
+	}
+
+	_, _, _, deltas := c.(Dumper).Dump()
+	var sum int64
+	for _, d := range deltas {
+		if d != 0 && d != 1 {
+			t.FailNow()
+		}
+		sum += d
+	}
+	if sum != c.(*slidingWindow[sync.Mutex, *sync.Mutex]).count {
+		t.FailNow()
+	}
+
+	s.Scale(0)
+	if c.Advance(now, 0) != 0 {
+		t.FailNow()
+	}
+
+	// The debt goes with the slots.
+	c = NewSlidingWindow(0, minute, 60, WithRevokeDebt(true))
+	s = c.(Scaler)
+	c.Advance(1500, 5)
+	c.Revoke(5000, 7)
+	if err := s.Scale(2); err != nil || c.(Debtor).Debt() != 14 {
+		t.FailNow()
+	}
+	s.Scale(0)
+	c.Advance(1800, 1)
+	if c.(Debtor).Debt() != 0 || c.(ActivityTracker).FirstActive() != 1800 {
+		t.FailNow()
+	}
+}
+
+func TestLoadBounded(t *testing.T) {
+	deltas := make([]int64, 1000)
+	for i := range deltas {
+		deltas[i] = 1
+	}
+
+	c := NewSlidingWindow(0, 60, 60)
+	begin := time.Now()
+	c.(Loader).Load(0, 1000*1e9, 1e9, deltas)
+	if time.Since(begin) > time.Second {
+		t.FailNow()
+	}
+	// The remainder of the last delta lands at the end.
+	if count := c.Advance(1000*1e9, 0); count != 1 {
+		t.Log(count)
+		t.FailNow()
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	now := time.Now().UnixMilli()
+	a := NewSlidingWindow(now, minute, 60)
+	b := NewSlidingWindow(now, minute, 60)
+	sum, min, max := NewSumCounter(a, b), NewMinCounter(a, b), NewMaxCounter(a, b)
+
+	a.Advance(now, 10)
+	b.Advance(now, 3)
+	if sum.Advance(now, 100) != 13 || min.Advance(now, 0) != 3 || max.Advance(now, 0) != 10 {
+		t.FailNow()
+	}
+
+	now += 30 * second
+	b.Advance(now, 20)
+	if sum.Advance(now, 0) != 33 || min.Advance(now, 0) != 10 || max.Advance(now, 0) != 23 {
+		t.FailNow()
+	}
+	if sum.Duration() != 30*second {
+		t.FailNow()
+	}
+
+	now += 45 * second
+	if sum.Advance(now, 0) != 20 || min.Advance(now, 0) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestMaxJump(t *testing.T) {
+	now := time.Now().UnixMilli()
+	far := now + 365*24*60*minute
+
+	c := NewSlidingWindow(now, minute, 60, WithMaxJump(120)).(CheckedCounter)
+	c.Advance(now, 10)
+	if count, err := c.AdvanceE(far, 1); err != ErrMaxJump || count != 10 {
+		t.FailNow()
+	}
+	// an isolated bogus moment stays refused
+	if c.Advance(now+second, 1) != 11 || c.Advance(far, 1) != 11 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(now+2*minute, 1); err != nil || count != 1 {
+		t.FailNow()
+	}
+
+	// After an idle time, the first update is refused and confirms the
+	// jump for the next ones.
+	now += 2 * minute
+	idle := now + 10*minute
+	if count, err := c.AdvanceE(idle, 5); err != ErrMaxJump || count != 1 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(idle+second, 5); err != nil || count != 5 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(idle+2*second, 5); err != nil || count != 10 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWindow(now, minute, 60).(CheckedCounter)
+	c.Advance(now, 10)
+	if count, err := c.AdvanceE(far, 1); err != nil || count != 1 {
+		t.FailNow()
+	}
+
+	// The reads neither arm nor confirm a jump.
+	c = NewSlidingWindow(0, minute, 60, WithMaxJump(120)).(CheckedCounter)
+	s := c.(SinceCounter)
+	c.Advance(0, 10)
+	if s.CountSince(999999, 0) != 10 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(999999, 5); err != ErrMaxJump || count != 10 {
+		t.FailNow()
+	}
+	if s.CountSince(second, 0) != 10 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(999999+second, 5); err != nil || count != 5 {
+		t.FailNow()
+	}
+}
+
+func TestAdvanceGuards(t *testing.T) {
+	now := time.Now().UnixMilli()
+
+	c := NewSlidingWindow(now, minute, 60, WithStrictTime(true)).(CheckedCounter)
+	c.Advance(now+second, 10)
+	if count, err := c.AdvanceE(now, 1); err != ErrBackwardTime || count != 10 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(now+second, 1); err != nil || count != 11 {
+		t.FailNow()
+	}
+	// the refused advance refuses the revoke too
+	if c.Radvance(now, now+second, 4) != 11 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWindow(now, minute, 60, WithSlotCap(100)).(CheckedCounter)
+	if count, err := c.AdvanceE(now, 150); err != ErrSlotCapped || count != 100 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(now+second, 1); err != nil || count != 101 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWindow(now, minute, 60, WithSaturation(true)).(CheckedCounter)
+	c.Advance(now, math.MaxInt64-5)
+	if count, err := c.AdvanceE(now+second, 10); err != ErrOverflow || count != math.MaxInt64 {
+		t.FailNow()
+	}
+	if count, err := c.AdvanceE(now+second, -10); err != nil || count != math.MaxInt64-10 {
+		t.FailNow()
+	}
+
+	// without the guards
+	c = NewSlidingWindow(now, minute, 60).(CheckedCounter)
+	c.Advance(now+second, 10)
+	if count, err := c.AdvanceE(now, 1); err != nil || count != 11 {
+		t.FailNow()
+	}
+}
+
+func TestActivity(t *testing.T) {
+	now := time.Now().UnixMilli()
+	now -= now % second
+	c := NewSlidingWindow(now, minute, 60)
+	a := c.(ActivityTracker)
+	if a.FirstActive() != -1 || a.LastActive() != -1 {
+		t.FailNow()
+	}
+
+	c.Advance(now+second/4, 1)
+	c.Advance(now+10*second, 0)
+	c.Advance(now+20*second+second/2, 1)
+	c.Advance(now+30*second, 0)
+	if a.FirstActive() != now+second/4 || a.LastActive() != now+20*second+second/2 {
+		t.FailNow()
+	}
+	if a.ActiveDuration(now+40*second) != 20*second+second/4 {
+		t.FailNow()
+	}
+
+	// The slot holding the first advance expires, the next one is known
+	// to its slot.
+	c.Advance(now+61*second, 0)
+	if a.FirstActive() != now+20*second {
+		t.Log(a.FirstActive() - now)
+		t.FailNow()
+	}
+
+	c.Advance(now+62*second, 1)
+	c.Revoke(now+20*second, 1)
+	if a.FirstActive() != now+62*second || a.LastActive() != now+62*second {
+		t.FailNow()
+	}
+
+	if a.ActiveDuration(now+70*second) != 0 {
+		t.FailNow()
+	}
+
+	c.Advance(now+3*minute, 0)
+	if a.FirstActive() != -1 || a.LastActive() != -1 || a.ActiveDuration(now+3*minute) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestRevokeDebt(t *testing.T) {
+	now := time.Now().UnixMilli()
+
+	c := NewSlidingWindow(now, minute, 60)
+	c.Advance(now, 3)
+	if c.Revoke(now, 5) != 0 || c.Revoke(now+second, 5) != 0 {
+		t.FailNow()
+	}
+	if c.Advance(now+second, 4) != 4 || c.(Debtor).Debt() != 0 {
+		t.FailNow()
+	}
+	if c.Advance(now+2*second, -10) != 0 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWindow(now, minute, 60, WithRevokeDebt(true))
+	c.Advance(now, 3)
+	if c.Revoke(now, 5) != 0 || c.Revoke(now+second, 5) != 0 {
+		t.FailNow()
+	}
+	if c.(Debtor).Debt() != 7 {
+		t.FailNow()
+	}
+	if c.Advance(now+second, 4) != 0 || c.Advance(now+second, 4) != 1 || c.(Debtor).Debt() != 0 {
+		t.FailNow()
+	}
+
+	c.Revoke(now+2*minute, 2)
+	c.Zero()
+	if c.(Debtor).Debt() != 0 {
+		t.FailNow()
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	now := time.Now().UnixMilli()
+	now -= now % second
+	a := NewSlidingWindowAligned(now, minute, 60)
+	b := NewSlidingWindowAligned(now+30*second, minute, 60)
+
+	for i := int64(0); i < 60; i++ {
+		a.Advance(now+i*second, i%3)
+	}
+	for i := int64(30); i < 90; i++ {
+		b.Advance(now+i*second, 1)
+	}
+
+	// a: 0,1,2,0,1,2... over [0,60), b: 1 over [30,90).
+	n, err := a.(Overlapper).Overlap(b)
+	t.Log(n, err)
+	if err != nil || n != 20 {
+		t.FailNow()
+	}
+	if n, _ := b.(Overlapper).Overlap(a); n != 20 {
+		t.FailNow()
+	}
+
+	b.Advance(now+3*minute, 1)
+	if n, err := a.(Overlapper).Overlap(b); err != nil || n != 0 {
+		t.FailNow()
+	}
+
+	if _, err := a.(Overlapper).Overlap(NewSlidingWindow(now, minute, 30)); err != ErrGeometry {
+		t.FailNow()
+	}
+	if _, err := a.(Overlapper).Overlap(NewSlidingWindow(now+1, minute, 60)); err != ErrGeometry {
+		t.FailNow()
+	}
+	if _, err := a.(Overlapper).Overlap(NewAccumulator(now)); err != ErrGeometry {
+		t.FailNow()
+	}
+}
+
+func TestSlotter(t *testing.T) {
+	now := time.Now().UnixMilli()
+	now -= now % second
+	c := NewSlidingWindowAligned(now, minute, 60)
+	s := c.(Slotter)
+	if s.LiveSlots() != 60 || s.PhysicalSlots() != 61 {
+		t.FailNow()
+	}
+
+	for i := int64(0); i < 120; i++ {
+		c.Advance(now+i*second, 10)
+	}
+
+	// The guard slot is a quarter expired.
+	now += 119*second + second/4
+	if c.Advance(now, 0) != 60*10+10-10/4 {
+		t.FailNow()
+	}
+	start, _, _, deltas := c.(Dumper).Dump()
+	if len(deltas) != s.PhysicalSlots() || start != now-second/4-60*second {
+		t.FailNow()
+	}
+}
+
+func TestEventChan(t *testing.T) {
+	now := time.Now().UnixMilli()
+	ch := make(chan Event, 3)
+	c := NewSlidingWindow(now, minute, 60, WithEventChan(ch))
+
+	c.Advance(now, 5)
+	c.Revoke(now, 2)
+	c.Radvance(now+second, now, 1)
+	c.Advance(now+second, 1)
+	c.Advance(now+second, 1)
+
+	want := []Event{
+		{OpAdvance, now, 0, 5, 5},
+		{OpRevoke, 0, now, 2, 3},
+		{OpRadvance, now + second, now, 1, 3},
+	}
+	for _, w := range want {
+		if e := <-ch; e != w {
+			t.Log(e)
+			t.FailNow()
+		}
+	}
+	if c.(EventPublisher).Dropped() != 2 {
+		t.FailNow()
+	}
+
+	// nothing is applied to a frozen window, nothing is published
+	c.(Freezer).Freeze()
+	c.Advance(now+second, 1)
+	c.Revoke(now, 1)
+	c.Radvance(now+second, now, 1)
+	if len(ch) != 0 || c.(EventPublisher).Dropped() != 2 {
+		t.FailNow()
+	}
+}
+
+func TestCompletedCount(t *testing.T) {
+	now := time.Now().UnixMilli()
+	now -= now % second
+	c := NewSlidingWindowAligned(now, minute, 60)
+	for i := int64(0); i < 90; i++ {
+		c.Advance(now+i*second, 10)
+	}
+
+	now += 90 * second
+	for _, off := range []int64{0, second / 4, second / 2, second - 1} {
+		c.Advance(now+off, 3)
+		full := c.Advance(now+off, 0)
+		_, tail := c.(TailAdvancer).AdvanceWithTail(now+off, 0, 1)
+		completed := c.(CompletedCounter).CompletedCount(now + off)
+		t.Log(full, tail, completed)
+		if completed != full-tail[0] {
+			t.FailNow()
+		}
+	}
+	if c.(CompletedCounter).CompletedCount(now+second-1) != 600-int64(10*float64(second-1)/float64(second)) {
+		t.FailNow()
+	}
+}
+
+func TestLockStats(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindowStats(now, minute, 60)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Advance(now, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	acquires, waitNanos := c.(LockStater).LockStats()
+	t.Log(acquires, waitNanos)
+	if acquires != 8000 || waitNanos < 0 {
+		t.FailNow()
+	}
+	if c.Advance(now, 0) != 8000 {
+		t.FailNow()
+	}
+
+	if acquires, _ := NewSlidingWindow(now, minute, 60).(LockStater).LockStats(); acquires != 0 {
+		t.FailNow()
+	}
+}
+
+func TestWriteInterpolation(t *testing.T) {
+	spread := func(interpolate bool) (int64, int64) {
+		now := time.Now().UnixMilli()
+		now -= now % second
+		c := NewSlidingWindowAligned(now, minute, 60, WithWriteInterpolation(interpolate))
+		for i := int64(0); i < 40; i++ {
+			c.Advance(now+i*second*3/2, 10)
+		}
+		count := c.Advance(now+59*second, 0)
+
+		_, _, _, deltas := c.(Dumper).Dump()
+		min, max := deltas[1], deltas[1]
+		for _, d := range deltas[1:58] {
+			if d < min {
+				min = d
+			}
+			if d > max {
+				max = d
+			}
+		}
+		return max - min, count
+	}
+
+	bucketed, n1 := spread(false)
+	interpolated, n2 := spread(true)
+	t.Log(bucketed, interpolated)
+	if interpolated >= bucketed || n1 != 400 || n2 != 400 {
+		t.FailNow()
+	}
+
+	now := time.Now().UnixMilli()
+	now -= now % second
+	c := NewSlidingWindowAligned(now, minute, 60, WithWriteInterpolation(true))
+	c.Advance(now+5*second+second/4, 8)
+	if c.Revoke(now+5*second+second/4, 8) != 0 {
+		t.FailNow()
+	}
+
+	// the loaded deltas are not spread again
+	c = NewSlidingWindow(0, 10*second, 10, WithWriteInterpolation(true))
+	c.(Loader).Load(0, 9500, second, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	_, _, _, deltas := c.(Dumper).Dump()
+	for i, d := range deltas {
+		if d != int64(i+1) {
+			t.Log(deltas)
+			t.FailNow()
+		}
+	}
+
+	for i := int64(0); i < 30; i++ {
+		c.Advance(10*second+i*700, 10)
+	}
+	start, end, step, deltas := c.(Dumper).Dump()
+	c2 := NewSlidingWindow(0, 10*second, 10, WithWriteInterpolation(true))
+	c2.(Loader).Load(start, end, step, deltas)
+	_, _, _, deltas2 := c2.(Dumper).Dump()
+	if len(deltas2) != len(deltas) || c2.Advance(end, 0) != c.Advance(end, 0) {
+		t.FailNow()
+	}
+	for i := range deltas {
+		if deltas[i] != deltas2[i] {
+			t.Log(deltas, deltas2)
+			t.FailNow()
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := newSlidingWindow[sync.Mutex](now, minute, 60, WithRevokeDebt(true))
+	for i := 0; i < 200; i++ {
+		c.Advance(now, int64(i%5))
+		c.Revoke(now-second, 1)
+		now += second / 3
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := []func(){
+		func() { c.count++ },
+		func() { c.slots[3] -= 7 },
+		func() { c.now = c.start - 1 },
+		func() { c.step = 0 },
+		func() { c.debt = -1 },
+	}
+	for _, f := range corrupt {
+		slots := append([]int64(nil), c.slots...)
+		start, step, count, now, debt := c.start, c.step, c.count, c.now, c.debt
+		f()
+		err := c.Validate()
+		t.Log(err)
+		if !errors.Is(err, ErrCorrupt) {
+			t.FailNow()
+		}
+		c.start, c.step, c.count, c.now, c.debt = start, step, count, now, debt
+		copy(c.slots, slots)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRawAccessor(t *testing.T) {
+	c := NewSlidingWindow(0, 60, 60)
+	r := c.(RawAccessor)
+	for i := 0; i < 61; i++ {
+		if err := r.SetSlot(i, int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.SetSlot(0, 100)
+	r.SetSlot(60, 0)
+	r.SetNow(59)
+	if err := c.(Validator).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Advance(59, 0) != 100+59*60/2 {
+		t.FailNow()
+	}
+
+	if r.SetSlot(-1, 1) != ErrSlotIndex || r.SetSlot(61, 1) != ErrSlotIndex {
+		t.FailNow()
+	}
+}
+
+func TestSlidingWithTotal(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWithTotal(now, minute, 60)
+
+	var last int64
+	for i := 0; i < 120; i++ {
+		c.Advance(now, 10)
+		if c.Total() < last {
+			t.FailNow()
+		}
+		last = c.Total()
+		now += second
+	}
+	if c.Total() != 1200 || c.Advance(now, 0) != 600 {
+		t.FailNow()
+	}
+
+	// The revoked part has already expired, nothing is taken back so the
+	// delta counts as new.
+	c.Radvance(now, now-2*minute, 5)
+	if c.Total() != 1205 || c.Advance(now, 0) != 605 {
+		t.FailNow()
+	}
+	c.Revoke(now, 5)
+	if c.Total() != 1200 || c.Advance(now, 0) != 600 {
+		t.FailNow()
+	}
+
+	now += 2 * minute
+	c.Zero()
+	if c.Total() != 1200 || c.Advance(now, 0) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestSlidingWithTotalRevoke(t *testing.T) {
+	c := NewSlidingWithTotal(0, minute, 60)
+	c.Advance(0, 5)
+	if c.Revoke(0, 1000) != 0 || c.Total() != 0 {
+		t.FailNow()
+	}
+
+	c.Advance(second, 5)
+	if c.Revoke(-2*minute, 5) != 5 || c.Total() != 5 {
+		t.FailNow()
+	}
+	if c.Revoke(2*minute, 5) != 5 || c.Total() != 5 {
+		t.FailNow()
+	}
+
+	// A debt is taken back in full.
+	c = NewSlidingWithTotal(0, minute, 60, WithRevokeDebt(true))
+	c.Advance(0, 5)
+	if c.Revoke(0, 7) != 0 || c.Total() != -2 {
+		t.FailNow()
+	}
+}
+
+func TestSlidingWithTotalGuards(t *testing.T) {
+	c := NewSlidingWithTotal(0, minute, 60, WithSlotCap(5))
+	if c.Advance(0, 10) != 5 || c.Total() != 10 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWithTotal(0, minute, 60, WithStrictTime(true))
+	c.Advance(5*second, 10)
+	if c.Advance(4*second, 3) != 10 || c.Total() != 10 {
+		t.FailNow()
+	}
+	if c.Radvance(4*second, 5*second, 4) != 10 || c.Total() != 10 {
+		t.FailNow()
+	}
+
+	c = NewSlidingWithTotal(0, minute, 60, WithSaturation(true))
+	c.Advance(0, math.MaxInt64)
+	if c.Advance(second, 1) != math.MaxInt64 || c.Total() != math.MaxInt64 {
+		t.FailNow()
+	}
+}
+
+func TestRingMask(t *testing.T) {
+	for _, slots := range []int{1, 3, 7, 15, 63, 255} {
+		now := time.Now().UnixMilli()
+		a := newSlidingWindow[nopLocker](now, minute, slots)
+		b := newSlidingWindow[nopLocker](now, minute, slots)
+		b.mask = 0
+		if a.mask != int64(slots) {
+			t.FailNow()
+		}
+
+		for i := 0; i < 5000; i++ {
+			now += int64(i*7919) % (2 * second)
+			delta := int64(i % 13)
+			if a.Advance(now, delta) != b.Advance(now, delta) {
+				t.FailNow()
+			}
+			if i%5 == 0 && a.Revoke(now-int64(i)%minute, 3) != b.Revoke(now-int64(i)%minute, 3) {
+				t.FailNow()
+			}
+		}
+
+		_, _, _, da := a.Dump()
+		_, _, _, db := b.Dump()
+		if len(da) != len(db) {
+			t.FailNow()
+		}
+		for i := range da {
+			if da[i] != db[i] {
+				t.FailNow()
+			}
+		}
+	}
+
+	if ringMask(61) != 0 || ringMask(64) != 63 {
+		t.FailNow()
+	}
+}
+
+func BenchmarkAdvanceMask(b *testing.B) {
+	for _, mask := range []bool{true, false} {
+		name := "mod"
+		if mask {
+			name = "mask"
+		}
+		b.Run(name, func(b *testing.B) {
+			now := time.Now().UnixMilli()
+			c := newSlidingWindow[nopLocker](now, minute, 63)
+			if !mask {
+				c.mask = 0
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Advance(now+int64(i)*100, 1)
+			}
+		})
+	}
+}
+
+func TestCloneLocked(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindowNoLock(now, minute, 60, WithHistory(8))
+	for i := 0; i < 30; i++ {
+		c.Advance(now, 10)
+		now += second
+	}
+
+	n := c.(LockedCloner).CloneLocked()
+	if n.Advance(now, 0) != 300 || len(n.(Historian).History()) != 8 {
+		t.FailNow()
+	}
+	if _, ok := n.(*slidingWindow[sync.Mutex, *sync.Mutex]); !ok {
+		t.FailNow()
+	}
+
+	// independent of the source
+	c.Advance(now, 100)
+	if n.Advance(now, 0) != 300 {
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				n.Advance(now, 1)
+				n.(Dumper).Dump()
+			}
+		}()
+	}
+	wg.Wait()
+	if n.Advance(now, 0) != 4300 {
+		t.FailNow()
+	}
+}
+
+func TestSlotCap(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60, WithSlotCap(100))
+
+	if c.Advance(now, 1000000) != 100 {
+		t.FailNow()
+	}
+	if c.Advance(now, 5) != 100 || c.(SlotCapper).ClampedTotal() != 1000000-100+5 {
+		t.FailNow()
+	}
+
+	now += second
+	if c.Advance(now, 50) != 150 {
+		t.FailNow()
+	}
+
+	// the revoke reduces against the capped slot
+	if c.Revoke(now-second, 40) != 110 || c.Advance(now, 60) != 160 {
+		t.FailNow()
+	}
+	if c.(SlotCapper).ClampedTotal() != 1000000-100+5+10 {
+		t.FailNow()
+	}
+}
+
+func TestTimeToThreshold(t *testing.T) {
+	c := NewSlidingWindow(0, minute, 60)
+	for i := int64(0); i < 60; i++ {
+		c.Advance(i*second, 10)
+	}
+
+	now := minute
+	f := c.(Forecaster)
+	// Half of the slots expire after 30s, then one tenth of the next one
+	// is needed to round the count below 300.
+	if f.TimeToThreshold(now, 300) != 30*second+100 {
+		t.FailNow()
+	}
+	if c.Advance(now+30*second+99, 0) != 300 || c.Advance(now+30*second+100, 0) != 299 {
+		t.FailNow()
+	}
+
+	now += 30*second + 100
+	if f.TimeToThreshold(now, 300) != 0 || f.TimeToThreshold(now, 0) != -1 {
+		t.FailNow()
+	}
+	// the last slot, advanced at 59s, expires at 120s
+	if f.TimeToThreshold(now, 1) != 2*minute-now {
+		t.FailNow()
+	}
+}
+
+func TestLoadCopySlots(t *testing.T) {
+	same := func(start, end, step int64, deltas []int64) bool {
+		a := newSlidingWindow[nopLocker](0, minute, 60)
+		b := newSlidingWindow[nopLocker](0, minute, 60)
+		dropped := a.LoadReport(start, end, step, deltas)
+		b.reset(start)
+		if b.replay(start, end, step, deltas) != dropped {
+			return false
+		}
+
+		if a.start != b.start || a.now != b.now || a.count != b.count ||
+			a.first != b.first || a.last != b.last || a.active != b.active {
+			return false
+		}
+		for j := range a.slots {
+			if a.get(int64(j)) != b.get(int64(j)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	now := time.Now().UnixMilli()
+	src := NewSlidingWindow(now, minute, 60)
+	for i := 0; i < 150; i++ {
+		if i%7 != 0 {
+			src.Advance(now, int64(i))
+		}
+		now += 700
+
+		start, end, step, deltas := src.(Dumper).Dump()
+		if !same(start, end, step, deltas) {
+			t.FailNow()
+		}
+		c := NewSlidingWindow(0, minute, 60)
+		if c.(LoadReporter).LoadReport(start, end, step, deltas) != 0 || c.Advance(end, 0) != src.Advance(end, 0) {
+			t.FailNow()
+		}
+	}
+
+	// end past the last slot, the oldest delta wraps around
+	deltas := make([]int64, 61)
+	for i := range deltas {
+		deltas[i] = int64(i + 1)
+	}
+	if !same(0, 61*second, second, deltas) || !same(0, 90*second, second, deltas[:10]) {
+		t.FailNow()
+	}
+	if !same(0, 60*second+500, second, deltas) {
+		t.FailNow()
+	}
+}
+
+func TestClassify(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	cl := c.(Classifier)
+	levels := []int64{100, 500, 1000}
+
+	c.Advance(now, 50)
+	if cl.Classify(now, levels) != -1 {
+		t.FailNow()
+	}
+	c.Advance(now, 450)
+	if cl.Classify(now, levels) != 1 {
+		t.FailNow()
+	}
+	c.Advance(now, 5000)
+	if cl.Classify(now, levels) != 2 {
+		t.FailNow()
+	}
+
+	if cl.Classify(now, []int64{1000, 100, 9000, 500}) != 0 || cl.Classify(now, nil) != -1 {
+		t.FailNow()
+	}
+	if cl.Classify(now+2*minute, []int64{1000, 0, 500}) != 1 {
+		t.FailNow()
+	}
+}
+
+func TestQuickReset(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := newSlidingWindow[nopLocker](now, minute, 60)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 60; i++ {
+			c.Advance(now, 10)
+			now += second
+		}
+
+		// The stale slots must not leak back while the ring refills.
+		now += 5 * minute
+		if c.Advance(now, 1) != 1 || c.Validate() != nil {
+			t.FailNow()
+		}
+		for i := 0; i < 58; i++ {
+			now += second
+			if c.Advance(now, 0) != 1 || c.Validate() != nil {
+				t.FailNow()
+			}
+		}
+		now += 5 * second
+		if c.Advance(now, 0) != 0 || c.Validate() != nil {
+			t.FailNow()
+		}
+	}
+
+	// generation wrap around
+	c.gen = math.MaxUint32
+	c.Advance(now, 7)
+	now += 5 * minute
+	if c.Advance(now, 3) != 3 || c.gen != 0 || c.Validate() != nil {
+		t.FailNow()
+	}
+	now += 30 * second
+	if c.Advance(now, 0) != 3 || c.Validate() != nil {
+		t.FailNow()
+	}
+}
+
+func BenchmarkQuickReset(b *testing.B) {
+	now := time.Now().UnixMilli()
+	c := newSlidingWindow[nopLocker](now, minute, 60000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now += 2 * minute
+		c.Advance(now, 1)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package countertest provides utilities for testing code that uses counters.
+package countertest
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/someonegg/counter"
+)
+
+// Clock is a deterministic fake clock, it is safe for concurrent use.
+type Clock struct {
+	now int64
+}
+
+func NewClock(start int64) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current moment, it can be passed where a now function
+// is expected.
+func (c *Clock) Now() int64 {
+	return atomic.LoadInt64(&c.now)
+}
+
+// Advance moves the clock forward by d and returns the new moment.
+func (c *Clock) Advance(d int64) int64 {
+	return atomic.AddInt64(&c.now, d)
+}
+
+func (c *Clock) Set(now int64) {
+	atomic.StoreInt64(&c.now, now)
+}
+
+// AssertCount fails t if the count of c at now is not want.
+func AssertCount(t testing.TB, c counter.Counter, now, want int64) {
+	t.Helper()
+	if got := c.Advance(now, 0); got != want {
+		t.Errorf("count at %d = %d, want %d", now, got, want)
+	}
+}
+
+// Run applies ops to c in order and returns the count after the last one.
+// It can replay the History of a counter, OpLoad is skipped since the
+// loaded data is not recorded.
+func Run(c counter.Counter, ops []counter.Op) (count int64) {
+	for _, op := range ops {
+		switch op.Kind {
+		case counter.OpAdvance:
+			count = c.Advance(op.Now, op.Delta)
+		case counter.OpRevoke:
+			count = c.Revoke(op.Hist, op.Delta)
+		case counter.OpRadvance:
+			count = c.Radvance(op.Now, op.Hist, op.Delta)
+		case counter.OpZero:
+			c.Zero()
+			count = 0
+		}
+	}
+	return
+}
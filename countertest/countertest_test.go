@@ -0,0 +1,50 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package countertest
+
+import (
+	"testing"
+
+	"github.com/someonegg/counter"
+)
+
+func TestClock(t *testing.T) {
+	c := NewClock(100)
+	if c.Advance(50) != 150 || c.Now() != 150 {
+		t.FailNow()
+	}
+	c.Set(10)
+	if c.Now() != 10 {
+		t.FailNow()
+	}
+}
+
+func TestRun(t *testing.T) {
+	clock := NewClock(0)
+	c := counter.NewSlidingWindow(clock.Now(), 60000, 60, counter.WithHistory(100))
+
+	var ops []counter.Op
+	for i := 0; i < 60; i++ {
+		ops = append(ops, counter.Op{Kind: counter.OpAdvance, Now: clock.Advance(1000), Delta: 10})
+	}
+	ops = append(ops, counter.Op{Kind: counter.OpRevoke, Hist: clock.Now(), Delta: 10})
+	ops = append(ops, counter.Op{Kind: counter.OpRadvance, Now: clock.Now(), Hist: clock.Now(), Delta: 5})
+
+	if Run(c, ops) != 595 {
+		t.FailNow()
+	}
+	AssertCount(t, c, clock.Now(), 595)
+	AssertCount(t, c, clock.Advance(1500), 590)
+
+	// Replaying the history gives the same result.
+	replay := counter.NewSlidingWindow(0, 60000, 60)
+	Run(replay, c.(counter.Historian).History())
+	AssertCount(t, replay, clock.Now(), 590)
+
+	ops = append(ops, counter.Op{Kind: counter.OpZero})
+	if Run(c, ops) != 0 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVCodec can exchange its history as CSV, one "timestamp,delta" row per
+// live slot, timestamp being the start of the slot, in milliseconds since
+// the epoch or as RFC3339, see WithCSVRFC3339.
+type CSVCodec interface {
+	// WriteCSV advances to now and writes the live slots.
+	WriteCSV(w io.Writer, now int64) error
+	// ReadCSV loads the slots written by WriteCSV. The position of now
+	// within the last slot is not preserved, now is set to its start.
+	ReadCSV(r io.Reader) error
+}
+
+var csvHeader = []string{"timestamp", "delta"}
+
+// csvTime keeps the milliseconds, so that the stamps read back exactly.
+const csvTime = "2006-01-02T15:04:05.000Z07:00"
+
+func (c *slidingWindow[L, PL]) formatStamp(stamp int64) string {
+	if c.opts.csvRFC3339 {
+		return time.UnixMilli(stamp).UTC().Format(csvTime)
+	}
+	return strconv.FormatInt(stamp, 10)
+}
+
+func parseStamp(s string) (int64, error) {
+	if stamp, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return stamp, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+func (c *slidingWindow[L, PL]) WriteCSV(w io.Writer, now int64) error {
+	r := c.copyRing(now, true)
+	defer ringPool.Put(r)
+
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for i := r.begin; i <= r.current; i++ {
+		cw.Write([]string{
+			c.formatStamp(r.start + i*r.step),
+			strconv.FormatInt(r.at(i), 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (c *slidingWindow[L, PL]) ReadCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+
+	var stamps, deltas []int64
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("counter: csv: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if line == 1 && record[0] == csvHeader[0] {
+			continue
+		}
+
+		stamp, err := parseStamp(record[0])
+		if err != nil {
+			return fmt.Errorf("counter: csv line %d: bad timestamp %q", line, record[0])
+		}
+		delta, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("counter: csv line %d: bad delta %q", line, record[1])
+		}
+		if n := len(stamps); n > 0 && stamp <= stamps[n-1] {
+			return fmt.Errorf("counter: csv line %d: timestamp not increasing", line)
+		}
+		if n := len(stamps); n > 1 && stamp-stamps[n-1] != stamps[1]-stamps[0] {
+			return fmt.Errorf("counter: csv line %d: timestamps not evenly spaced", line)
+		}
+		stamps = append(stamps, stamp)
+		deltas = append(deltas, delta)
+	}
+	if len(stamps) == 0 {
+		return errors.New("counter: csv: no rows")
+	}
+
+	step := c.Resolution()
+	if len(stamps) > 1 {
+		step = stamps[1] - stamps[0]
+	}
+	c.Load(stamps[0], stamps[len(stamps)-1], step, deltas)
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSV(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	for i := 0; i < 90; i++ {
+		c.Advance(now, int64(i))
+		now += second
+	}
+
+	var buf bytes.Buffer
+	if err := c.(CSVCodec).WriteCSV(&buf, now); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(buf.String())
+
+	c2 := NewSlidingWindow(now, minute, 60)
+	if err := c2.(CSVCodec).ReadCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	now += second / 3
+	if c.Advance(now, 0) != c2.Advance(now, 0) {
+		t.FailNow()
+	}
+
+	// The RFC3339 stamps read back the same.
+	c3 := NewSlidingWindow(now, minute, 60, WithCSVRFC3339(true))
+	for i := 0; i < 90; i++ {
+		c3.Advance(now, int64(i))
+		now += second
+	}
+	buf.Reset()
+	if err := c3.(CSVCodec).WriteCSV(&buf, now); err != nil {
+		t.Fatal(err)
+	}
+	first := strings.Split(buf.String(), "\n")[1]
+	stamp := strings.Split(first, ",")[0]
+	if _, err := time.Parse(time.RFC3339, stamp); err != nil || !strings.HasSuffix(stamp, "Z") {
+		t.Fatal(stamp, err)
+	}
+	if err := c2.(CSVCodec).ReadCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	now += second / 3
+	if c3.Advance(now, 0) != c2.Advance(now, 0) {
+		t.FailNow()
+	}
+	if err := c2.(CSVCodec).ReadCSV(strings.NewReader("timestamp,delta\n1970-01-01T00:00:01.000Z,3\n1970-01-01T00:00:02Z,4\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, deltas := c2.(Dumper).Dump(); len(deltas) == 0 || deltas[len(deltas)-1] != 4 {
+		t.FailNow()
+	}
+
+	bad := []string{
+		"",
+		"timestamp,delta\n",
+		"timestamp,delta\n1000,x\n",
+		"1000,1\n2000\n",
+		"1000,1\n2000,1\n4000,1\n",
+		"2000,1\n1000,1\n",
+		"1970-01-01 00:00:01,1\n",
+	}
+	for _, in := range bad {
+		err := c2.(CSVCodec).ReadCSV(strings.NewReader(in))
+		t.Log(err)
+		if err == nil {
+			t.FailNow()
+		}
+	}
+}
+
+func TestCSVNotRecorded(t *testing.T) {
+	now := time.Now().UnixMilli()
+	events := make(chan Event, 4)
+	c := NewSlidingWindow(now, minute, 60, WithHistory(4), WithEventChan(events))
+	c.Advance(now, 1)
+	<-events
+
+	var buf bytes.Buffer
+	if err := c.(CSVCodec).WriteCSV(&buf, now+second); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.(Historian).History()) != 1 || len(events) != 0 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import "sync/atomic"
+
+// OpKind is the kind of an operation on a counter.
+type OpKind int
+
+const (
+	OpAdvance OpKind = iota
+	OpRevoke
+	OpRadvance
+	OpZero
+	OpLoad
+)
+
+// Op is an operation on a counter, Hist is the historical moment of
+// revokes and the start of loads.
+type Op struct {
+	Kind  OpKind
+	Now   int64
+	Hist  int64
+	Delta int64
+}
+
+// Event is published for an operation on a counter, Count is the count
+// after it.
+type Event struct {
+	Op    OpKind
+	Now   int64
+	Hist  int64
+	Delta int64
+	Count int64
+}
+
+// EventPublisher reports the events that could not be published.
+type EventPublisher interface {
+	Dropped() int64
+}
+
+// emit must not be called with the lock held. The events from a single
+// goroutine are published in order. Nothing is published unless applied,
+// that is unless the window was not frozen.
+func (c *slidingWindow[L, PL]) emit(kind OpKind, now, hist, delta int64, count *int64, applied *bool) {
+	if c.opts.events == nil || !*applied {
+		return
+	}
+	select {
+	case c.opts.events <- Event{kind, now, hist, delta, *count}:
+	default:
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+func (c *slidingWindow[L, PL]) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+// Historian remembers the last operations applied to it.
+type Historian interface {
+	// History returns the recorded operations, oldest first.
+	History() []Op
+}
+
+// WithHistory records the last n operations, for replaying what happened
+// to a misbehaving counter.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.history = n
+	}
+}
+
+type history struct {
+	ops  []Op
+	next int
+	full bool
+}
+
+func newHistory(n int) *history {
+	if n <= 0 {
+		return nil
+	}
+	return &history{ops: make([]Op, n)}
+}
+
+func (h *history) add(op Op) {
+	h.ops[h.next] = op
+	h.next++
+	if h.next == len(h.ops) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+func (h *history) list() []Op {
+	if !h.full {
+		return append([]Op(nil), h.ops[:h.next]...)
+	}
+	ops := make([]Op, 0, len(h.ops))
+	ops = append(ops, h.ops[h.next:]...)
+	return append(ops, h.ops[:h.next]...)
+}
+
+// record returns false if the window is frozen and the operation will
+// not be applied.
+func (c *slidingWindow[L, PL]) record(kind OpKind, now, hist, delta int64) bool {
+	if c.frozen {
+		return false
+	}
+	if c.hist != nil {
+		c.hist.add(Op{kind, now, hist, delta})
+	}
+	return true
+}
+
+func (c *slidingWindow[L, PL]) History() []Op {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	if c.hist == nil {
+		return nil
+	}
+	return c.hist.list()
+}
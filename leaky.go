@@ -0,0 +1,75 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import "sync"
+
+// LeakyBucket is a level that drains continuously at a fixed rate, it is
+// safe for concurrent use by multiple goroutines.
+type LeakyBucket interface {
+	// Add drains the bucket to now and adds delta to it. The part that
+	// does not fit into the capacity is returned as overflow.
+	Add(now int64, delta int64) (level int64, overflow int64)
+	// Level drains the bucket to now and returns its level.
+	Level(now int64) int64
+}
+
+type leakyBucket struct {
+	l        sync.Mutex
+	now      int64
+	rate     int64
+	capacity int64
+	// level in thousandths, so that a millisecond of leak is not lost.
+	level int64
+}
+
+// NewLeakyBucket creates a LeakyBucket, the moments are in milliseconds.
+// A partially drained unit still counts as one.
+func NewLeakyBucket(start, leakRatePerSec int64, capacity int64) LeakyBucket {
+	return &leakyBucket{
+		now:      start,
+		rate:     leakRatePerSec,
+		capacity: capacity,
+	}
+}
+
+func (b *leakyBucket) Add(now int64, delta int64) (level int64, overflow int64) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.drain(now)
+
+	level = b.units()
+	if level+delta > b.capacity {
+		overflow = level + delta - b.capacity
+		delta -= overflow
+	}
+	b.level += delta * 1000
+	if b.level < 0 {
+		b.level = 0
+	}
+	return b.units(), overflow
+}
+
+func (b *leakyBucket) Level(now int64) int64 {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.drain(now)
+	return b.units()
+}
+
+func (b *leakyBucket) drain(now int64) {
+	if now <= b.now {
+		return
+	}
+	b.level -= b.rate * (now - b.now)
+	if b.level < 0 {
+		b.level = 0
+	}
+	b.now = now
+}
+
+func (b *leakyBucket) units() int64 {
+	return (b.level + 999) / 1000
+}
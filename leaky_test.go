@@ -0,0 +1,44 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeakyBucket(t *testing.T) {
+	now := time.Now().UnixMilli()
+	b := NewLeakyBucket(now, 10, 100)
+
+	if level, overflow := b.Add(now, 80); level != 80 || overflow != 0 {
+		t.FailNow()
+	}
+	if level, overflow := b.Add(now, 30); level != 100 || overflow != 10 {
+		t.FailNow()
+	}
+
+	// 10 per second.
+	now += 2 * second
+	if b.Level(now) != 80 {
+		t.FailNow()
+	}
+	now += second / 20
+	if b.Level(now) != 80 {
+		t.FailNow()
+	}
+	now += second / 20
+	if b.Level(now) != 79 {
+		t.FailNow()
+	}
+
+	now += 10 * second
+	if b.Level(now) != 0 {
+		t.FailNow()
+	}
+	if level, overflow := b.Add(now, 150); level != 100 || overflow != 50 {
+		t.FailNow()
+	}
+}
@@ -4,10 +4,16 @@
 
 package counter
 
-import "sync"
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type locker[L any] interface {
 	sync.Locker
+	TryLock() bool
 	*L
 }
 
@@ -16,3 +22,66 @@ type nopLocker struct{}
 func (l nopLocker) Lock() {}
 
 func (l nopLocker) Unlock() {}
+
+func (l nopLocker) TryLock() bool { return true }
+
+// statsLocker is a mutex counting its acquisitions and the time spent
+// waiting for it.
+type statsLocker struct {
+	mu        sync.Mutex
+	acquires  int64
+	waitNanos int64
+}
+
+func (l *statsLocker) Lock() {
+	if !l.mu.TryLock() {
+		begin := time.Now()
+		l.mu.Lock()
+		atomic.AddInt64(&l.waitNanos, int64(time.Since(begin)))
+	}
+	atomic.AddInt64(&l.acquires, 1)
+}
+
+func (l *statsLocker) Unlock() {
+	l.mu.Unlock()
+}
+
+func (l *statsLocker) TryLock() bool {
+	if !l.mu.TryLock() {
+		return false
+	}
+	atomic.AddInt64(&l.acquires, 1)
+	return true
+}
+
+const spinLimit = 64
+
+// spinLocker spins on a CAS, yielding the processor after spinLimit failed
+// attempts.
+//
+// It wins over sync.Mutex when the critical sections are a few slot
+// writes and there are spare cores, so the holder releases the lock before
+// the spinner would have parked. It loses when the holder can be
+// descheduled, e.g. with many more goroutines than cores, or when the
+// critical sections are long, as spinners then burn the CPU the holder
+// needs.
+type spinLocker struct {
+	state int32
+}
+
+func (l *spinLocker) Lock() {
+	for i := 0; !atomic.CompareAndSwapInt32(&l.state, 0, 1); i++ {
+		if i == spinLimit {
+			runtime.Gosched()
+			i = 0
+		}
+	}
+}
+
+func (l *spinLocker) Unlock() {
+	atomic.StoreInt32(&l.state, 0)
+}
+
+func (l *spinLocker) TryLock() bool {
+	return atomic.CompareAndSwapInt32(&l.state, 0, 1)
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpinLocker(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindowSpin(now, minute, 60)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Advance(now, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if c.Advance(now, 0) != 8000 {
+		t.FailNow()
+	}
+}
+
+func benchmarkContended(b *testing.B, c Counter) {
+	now := time.Now().UnixMilli()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Advance(now, 1)
+		}
+	})
+}
+
+func BenchmarkLockerMutex(b *testing.B) {
+	benchmarkContended(b, NewSlidingWindow(time.Now().UnixMilli(), minute, 60))
+}
+
+func BenchmarkLockerSpin(b *testing.B) {
+	benchmarkContended(b, NewSlidingWindowSpin(time.Now().UnixMilli(), minute, 60))
+}
+
+// The nop locker is not safe under contention, it is the uncontended
+// baseline.
+func BenchmarkLockerNop(b *testing.B) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindowNoLock(now, minute, 60)
+	for i := 0; i < b.N; i++ {
+		c.Advance(now, 1)
+	}
+}
+
+func TestTryAdvance(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := newSlidingWindow[sync.Mutex](now, minute, 60)
+
+	c.l.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, ok := c.TryAdvance(now, 1); ok {
+			t.Error("acquired a held lock")
+		}
+	}()
+	<-done
+	c.l.Unlock()
+
+	if count, ok := c.TryAdvance(now, 1); !ok || count != 1 {
+		t.FailNow()
+	}
+
+	n := NewSlidingWindowNoLock(now, minute, 60).(TryAdvancer)
+	if count, ok := n.TryAdvance(now, 2); !ok || count != 2 {
+		t.FailNow()
+	}
+	s := NewSlidingWindowSpin(now, minute, 60).(TryAdvancer)
+	if count, ok := s.TryAdvance(now, 3); !ok || count != 3 {
+		t.FailNow()
+	}
+}
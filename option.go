@@ -0,0 +1,167 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import "math"
+
+// Option configures a sliding window.
+type Option func(*options)
+
+type options struct {
+	rounding Rounding
+	labels   map[string]string
+	history  int
+	maxJump  int64
+
+	revokeDebt  bool
+	events      chan<- Event
+	interpolate bool
+	slotCap     int64
+	saturate    bool
+	strictTime  bool
+	csvRFC3339  bool
+
+	variance bool
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Rounding controls how the partially expired part of the oldest slot
+// is rounded to an integer.
+type Rounding int
+
+const (
+	// Trunc rounds toward zero, it is the default.
+	Trunc Rounding = iota
+	// Nearest rounds half away from zero.
+	Nearest
+	// Floor rounds toward negative infinity.
+	Floor
+)
+
+func (r Rounding) round(x float64) int64 {
+	switch r {
+	case Nearest:
+		return int64(math.Round(x))
+	case Floor:
+		return int64(math.Floor(x))
+	}
+	return int64(x)
+}
+
+// WithRounding sets the rounding mode of the partial expiry.
+//
+// Trunc systematically over-counts by up to one unit per query, Nearest
+// keeps the error centered around zero.
+func WithRounding(r Rounding) Option {
+	return func(o *options) {
+		o.rounding = r
+	}
+}
+
+// WithLabels attaches metadata to the counter, it is carried through
+// Snapshot and LoadSnapshot and otherwise ignored.
+func WithLabels(labels map[string]string) Option {
+	return func(o *options) {
+		o.labels = copyLabels(labels)
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for k, v := range labels {
+		m[k] = v
+	}
+	return m
+}
+
+// WithMaxJump refuses to advance more than steps slots at once, instead
+// of silently resetting the window. The refused updates are ignored, and
+// reported as ErrMaxJump by AdvanceE. A refused jump is accepted when the
+// next update confirms it, by landing at most steps slots after it, so
+// the first update after a long enough idle time is refused, and can be
+// retried.
+func WithMaxJump(steps int64) Option {
+	return func(o *options) {
+		o.maxJump = steps
+	}
+}
+
+// WithRevokeDebt chooses what happens when a revoke is larger than what
+// its slot holds, or comes before its advance. By default the excess is
+// dropped. In debt mode it is recorded as a debt, that later advances pay
+// off before increasing the count.
+func WithRevokeDebt(debt bool) Option {
+	return func(o *options) {
+		o.revokeDebt = debt
+	}
+}
+
+// WithEventChan publishes an Event to ch for every advance and revoke. The
+// publishing happens after the lock is released and never blocks, the
+// events that do not fit are dropped and counted.
+func WithEventChan(ch chan<- Event) Option {
+	return func(o *options) {
+		o.events = ch
+	}
+}
+
+// WithWriteInterpolation spreads every delta over the step before its
+// moment, splitting it between its slot and the previous one in
+// proportion to how far into its slot it lands. This reduces the
+// quantization of sub-window queries. The following slot cannot be used,
+// it is the guard slot still holding the oldest deltas. Revoke splits the
+// same way.
+func WithWriteInterpolation(interpolate bool) Option {
+	return func(o *options) {
+		o.interpolate = interpolate
+	}
+}
+
+// WithSlotCap bounds the total of every slot to max, so that a burst at
+// one moment cannot dominate the count. The excess of an advance is
+// dropped and counted, see SlotCapper, and reported as ErrSlotCapped by
+// AdvanceE. Zero means no cap.
+func WithSlotCap(max int64) Option {
+	return func(o *options) {
+		o.slotCap = max
+	}
+}
+
+// WithSaturation clamps the advances that would overflow the count or a
+// slot, instead of letting them wrap around. They are reported as
+// ErrOverflow by AdvanceE.
+func WithSaturation(saturate bool) Option {
+	return func(o *options) {
+		o.saturate = saturate
+	}
+}
+
+// WithStrictTime refuses the advances going back in time, instead of
+// adding them to the current slot. The refused updates are ignored, and
+// reported as ErrBackwardTime by AdvanceE.
+func WithStrictTime(strict bool) Option {
+	return func(o *options) {
+		o.strictTime = strict
+	}
+}
+
+// WithCSVRFC3339 makes WriteCSV write the timestamps as RFC3339 in UTC,
+// with milliseconds, instead of milliseconds since the epoch. ReadCSV
+// accepts both anyway.
+func WithCSVRFC3339(rfc3339 bool) Option {
+	return func(o *options) {
+		o.csvRFC3339 = rfc3339
+	}
+}
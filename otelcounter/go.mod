@@ -0,0 +1,24 @@
+module github.com/someonegg/counter/otelcounter
+
+go 1.20
+
+require (
+	github.com/someonegg/counter v0.0.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/metric v1.24.0
+	go.opentelemetry.io/otel/sdk/metric v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/sdk v1.24.0 // indirect
+	go.opentelemetry.io/otel/trace v1.24.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+)
+
+// The counter module lives in the same repository, otelcounter builds
+// against the tree it is checked out with. The replace does not apply to
+// the modules depending on otelcounter, they must require or replace a
+// version of github.com/someonegg/counter themselves.
+replace github.com/someonegg/counter => ../
@@ -0,0 +1,78 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otelcounter exports counters as OpenTelemetry metrics. It is a
+// separate module, so that the counter package does not depend on otel.
+package otelcounter
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/someonegg/counter"
+)
+
+// Source is a counter to export.
+type Source struct {
+	Name       string
+	Counter    counter.Counter
+	Attributes []attribute.KeyValue
+}
+
+// Naming returns the instrument name of a source, kind being "value"
+// or "rate".
+type Naming func(name, kind string) string
+
+// DefaultNaming joins the name and the kind with a dot.
+func DefaultNaming(name, kind string) string {
+	return name + "." + kind
+}
+
+// Register creates two asynchronous gauges per source, observed at each
+// collection: the count at now, and the rate in events per second, now
+// being in milliseconds. A nil naming means DefaultNaming.
+//
+// Unregister the returned registration to stop observing the sources.
+func Register(m metric.Meter, now func() int64, naming Naming, sources ...Source) (metric.Registration, error) {
+	if naming == nil {
+		naming = DefaultNaming
+	}
+
+	type gauges struct {
+		value metric.Int64ObservableGauge
+		rate  metric.Float64ObservableGauge
+		attrs metric.MeasurementOption
+	}
+
+	all := make([]gauges, len(sources))
+	insts := make([]metric.Observable, 0, 2*len(sources))
+	for i, s := range sources {
+		value, err := m.Int64ObservableGauge(naming(s.Name, "value"))
+		if err != nil {
+			return nil, err
+		}
+		rate, err := m.Float64ObservableGauge(naming(s.Name, "rate"), metric.WithUnit("1/s"))
+		if err != nil {
+			return nil, err
+		}
+		all[i] = gauges{value, rate, metric.WithAttributes(s.Attributes...)}
+		insts = append(insts, value, rate)
+	}
+
+	return m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		t := now()
+		for i, s := range sources {
+			count := s.Counter.Advance(t, 0)
+			var rate float64
+			if dur := s.Counter.Duration(); dur > 0 {
+				rate = float64(count) * 1000 / float64(dur)
+			}
+			o.ObserveInt64(all[i].value, count, all[i].attrs)
+			o.ObserveFloat64(all[i].rate, rate, all[i].attrs)
+		}
+		return nil
+	}, insts...)
+}
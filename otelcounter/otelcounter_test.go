@@ -0,0 +1,79 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelcounter
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/someonegg/counter"
+	"github.com/someonegg/counter/countertest"
+)
+
+const (
+	second int64 = 1000
+	minute int64 = 60 * second
+)
+
+func TestRegister(t *testing.T) {
+	clock := countertest.NewClock(1000 * minute)
+	c := counter.NewSlidingWindow(clock.Now(), minute, 60)
+	for i := 0; i < 90; i++ {
+		c.Advance(clock.Now(), 2)
+		clock.Advance(second)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	attrs := []attribute.KeyValue{attribute.String("route", "/api")}
+	reg, err := Register(provider.Meter("test"), clock.Now, nil,
+		Source{Name: "requests", Counter: c, Attributes: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	want := c.Advance(clock.Now(), 0)
+	var seen int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch m.Name {
+			case "requests.value":
+				dp := m.Data.(metricdata.Gauge[int64]).DataPoints
+				if len(dp) != 1 || dp[0].Value != want {
+					t.FailNow()
+				}
+				if v, _ := dp[0].Attributes.Value("route"); v.AsString() != "/api" {
+					t.FailNow()
+				}
+			case "requests.rate":
+				dp := m.Data.(metricdata.Gauge[float64]).DataPoints
+				if len(dp) != 1 || dp[0].Value != float64(want)/60 {
+					t.FailNow()
+				}
+			default:
+				t.FailNow()
+			}
+			seen++
+		}
+	}
+	if seen != 2 {
+		t.FailNow()
+	}
+
+	if err := reg.Unregister(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import "sync"
+
+// PercentileCounter is a sliding window that also remembers its past
+// counts, to tell how unusual the current one is.
+type PercentileCounter interface {
+	Counter
+	// Percentile advances to now and returns the percentile rank, in
+	// [0, 100], of the count among the remembered ones, the equal ones
+	// counting for half. It returns -1 if nothing is remembered yet.
+	Percentile(now int64) float64
+}
+
+type percentileWindow struct {
+	l      sync.Mutex
+	w      *slidingWindow[nopLocker, *nopLocker]
+	start  int64
+	window int64
+	epoch  int64
+
+	samples []int64
+	next    int
+	full    bool
+}
+
+// NewPercentileWindow creates a PercentileCounter remembering the counts
+// at the last samples moments the window fully rolled, that is at every
+// multiple of window since start.
+func NewPercentileWindow(start, window int64, slots int, samples int, opts ...Option) PercentileCounter {
+	if samples < 1 {
+		samples = 1
+	}
+	return &percentileWindow{
+		w:       newSlidingWindow[nopLocker](start, window, slots, opts...),
+		start:   start,
+		window:  window,
+		samples: make([]int64, samples),
+	}
+}
+
+// roll samples the counts at the window ends up to now. After a long
+// idle time only the last len(samples) ends are sampled, the older ones
+// would be overwritten anyway.
+func (c *percentileWindow) roll(now int64) {
+	epoch := (now - c.start) / c.window
+	if epoch <= c.epoch {
+		return
+	}
+	from := c.epoch + 1
+	if n := int64(len(c.samples)); epoch-from >= n {
+		from = epoch - n + 1
+	}
+	for e := from; e <= epoch; e++ {
+		// a sample is a read, it is neither published nor recorded
+		c.w.peek(c.start + e*c.window)
+		c.samples[c.next] = c.w.calculate()
+		c.next++
+		if c.next == len(c.samples) {
+			c.next, c.full = 0, true
+		}
+	}
+	c.epoch = epoch
+}
+
+func (c *percentileWindow) Advance(now int64, delta int64) int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.roll(now)
+	return c.w.Advance(now, delta)
+}
+
+func (c *percentileWindow) Revoke(hist int64, delta int64) int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.w.Revoke(hist, delta)
+}
+
+func (c *percentileWindow) Radvance(now, hist int64, delta int64) int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.roll(now)
+	return c.w.Radvance(now, hist, delta)
+}
+
+func (c *percentileWindow) Zero() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.w.Zero()
+}
+
+func (c *percentileWindow) Duration() int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.w.Duration()
+}
+
+func (c *percentileWindow) Percentile(now int64) float64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.roll(now)
+	c.w.peek(now)
+	count := c.w.calculate()
+
+	n := c.next
+	if c.full {
+		n = len(c.samples)
+	}
+	if n == 0 {
+		return -1
+	}
+	var below, equal int
+	for _, v := range c.samples[:n] {
+		if v < count {
+			below++
+		} else if v == count {
+			equal++
+		}
+	}
+	return (float64(below) + float64(equal)/2) * 100 / float64(n)
+}
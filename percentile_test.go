@@ -0,0 +1,53 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import "testing"
+
+func TestPercentileWindow(t *testing.T) {
+	c := NewPercentileWindow(0, minute, 60, 10)
+	if c.Percentile(0) != -1 {
+		t.FailNow()
+	}
+
+	// The windows 0 to 9 count 10, 20, ..., 100, sampled when they end.
+	for k := int64(0); k < 10; k++ {
+		c.Advance(k*minute+second, (k+1)*10)
+	}
+	c.Advance(10*minute+2*second, 55)
+
+	now := 10*minute + 59*second
+	if c.Advance(now, 0) != 55 || c.Percentile(now) != 50 {
+		t.FailNow()
+	}
+	c.Advance(now, 45)
+	if c.Percentile(now) != 95 {
+		t.FailNow()
+	}
+
+	// The window 10 is sampled as 100, then four idle ones as 0, which
+	// overwrite the 10 to 50 samples.
+	now += 5 * minute
+	c.Advance(now, 1)
+	if c.Percentile(now) != 40 {
+		t.FailNow()
+	}
+}
+
+func TestPercentileWindowSilent(t *testing.T) {
+	events := make(chan Event, 16)
+	c := NewPercentileWindow(0, minute, 60, 10, WithEventChan(events), WithHistory(16))
+	c.Advance(second, 1)
+	c.Advance(5*minute+second, 1)
+	if c.Percentile(10*minute) != 40 {
+		t.FailNow()
+	}
+
+	// Only the two advances show, not the reads nor the samples taken at
+	// the ends.
+	if len(events) != 2 || len(c.(*percentileWindow).w.History()) != 2 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SnapshotVersion is the version of the Snapshot form, it is bumped
+// whenever the serialized form changes. Version 1 had no version field.
+const SnapshotVersion = 2
+
+// ErrSnapshotVersion is returned by MigrateSnapshot for unknown versions.
+var ErrSnapshotVersion = errors.New("counter: unknown snapshot version")
+
+// Snapshot is the self-describing form of a Dump.
+type Snapshot struct {
+	Version int               `json:"version"`
+	Start   int64             `json:"start"`
+	End     int64             `json:"end"`
+	Step    int64             `json:"step"`
+	Deltas  []int64           `json:"deltas"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+type snapshotV1 struct {
+	Start  int64             `json:"start"`
+	End    int64             `json:"end"`
+	Step   int64             `json:"step"`
+	Deltas []int64           `json:"deltas"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// MigrateSnapshot decodes a JSON snapshot of any known version, upgrading
+// it to the current one.
+func MigrateSnapshot(raw []byte) (Snapshot, error) {
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return Snapshot{}, fmt.Errorf("counter: snapshot: %w", err)
+	}
+
+	var s Snapshot
+	switch probe.Version {
+	case 0, 1:
+		var v1 snapshotV1
+		if err := json.Unmarshal(raw, &v1); err != nil {
+			return Snapshot{}, fmt.Errorf("counter: snapshot: %w", err)
+		}
+		s = Snapshot{SnapshotVersion, v1.Start, v1.End, v1.Step, v1.Deltas, v1.Labels}
+	case SnapshotVersion:
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return Snapshot{}, fmt.Errorf("counter: snapshot: %w", err)
+		}
+	default:
+		return Snapshot{}, ErrSnapshotVersion
+	}
+	return s, nil
+}
+
+// Canonical returns s relative to a zero epoch, with the trailing zero
+// deltas trimmed, so that the snapshots of windows differing only by
+// their absolute moments serialize identically. LoadSnapshot restores
+// the same window from it, shifted in time.
+func (s Snapshot) Canonical() Snapshot {
+	n := len(s.Deltas)
+	for n > 0 && s.Deltas[n-1] == 0 {
+		n--
+	}
+	return Snapshot{
+		Version: s.Version,
+		Start:   0,
+		End:     s.End - s.Start,
+		Step:    s.Step,
+		Deltas:  append([]int64{}, s.Deltas[:n]...),
+		Labels:  copyLabels(s.Labels),
+	}
+}
+
+// Snapshotter can save and restore its state together with its labels.
+type Snapshotter interface {
+	Snapshot() Snapshot
+	// LoadSnapshot is like Load, then also moves to the end of s, which
+	// may be after its last delta, see Snapshot.Canonical.
+	LoadSnapshot(s Snapshot)
+	Labels() map[string]string
+}
+
+func (c *slidingWindow[L, PL]) Snapshot() Snapshot {
+	s := Snapshot{Version: SnapshotVersion}
+	s.Start, s.End, s.Step, s.Deltas = c.Dump()
+	s.Labels = c.Labels()
+	return s
+}
+
+func (c *slidingWindow[L, PL]) LoadSnapshot(s Snapshot) {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	if c.frozen {
+		return
+	}
+	c.opts.labels = copyLabels(s.Labels)
+	c.load(s.Start, s.End, s.Step, s.Deltas)
+	c.move(s.End, 0)
+}
+
+// Downsampler can shrink its snapshots.
+type Downsampler interface {
+	// DumpDownsampled advances to now and returns a snapshot with at most
+	// maxSlots deltas, each summing adjacent slots, with a proportionally
+	// larger step. The total is preserved exactly.
+	DumpDownsampled(now int64, maxSlots int) Snapshot
+}
+
+func (c *slidingWindow[L, PL]) DumpDownsampled(now int64, maxSlots int) Snapshot {
+	if maxSlots < 1 {
+		maxSlots = 1
+	}
+	labels := c.Labels()
+	r := c.copyRing(now, true)
+	defer ringPool.Put(r)
+
+	n := r.current - r.begin + 1
+	group := (n + int64(maxSlots) - 1) / int64(maxSlots)
+	s := Snapshot{
+		Version: SnapshotVersion,
+		Start:   r.start + r.begin*r.step,
+		End:     r.end,
+		Step:    r.step * group,
+		Deltas:  make([]int64, 0, (n+group-1)/group),
+		Labels:  labels,
+	}
+	for i := r.begin; i <= r.current; i += group {
+		var sum int64
+		for j := i; j < i+group && j <= r.current; j++ {
+			sum += r.at(j)
+		}
+		s.Deltas = append(s.Deltas, sum)
+	}
+	return s
+}
+
+// SnapshotContinuer can restore a snapshot taken in the past.
+type SnapshotContinuer interface {
+	// LoadAndContinue atomically loads s and advances to now, so the
+	// slots that expired since s was taken are never observed.
+	LoadAndContinue(s Snapshot, now int64)
+}
+
+func (c *slidingWindow[L, PL]) LoadAndContinue(s Snapshot, now int64) {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	if c.frozen {
+		return
+	}
+	c.opts.labels = copyLabels(s.Labels)
+	c.load(s.Start, s.End, s.Step, s.Deltas)
+	c.move(now, 0)
+}
+
+func (c *slidingWindow[L, PL]) Labels() map[string]string {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	return copyLabels(c.opts.labels)
+}
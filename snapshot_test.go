@@ -0,0 +1,193 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSnapshotLabels(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60, WithLabels(map[string]string{"name": "qps", "region": "eu"}))
+	for i := 0; i < 90; i++ {
+		c.Advance(now, 10)
+		now += second
+	}
+
+	data, err := json.Marshal(c.(Snapshotter).Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(string(data))
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	c2 := NewSlidingWindow(now, minute, 60)
+	c2.(Snapshotter).LoadSnapshot(s)
+
+	labels := c2.(Snapshotter).Labels()
+	if len(labels) != 2 || labels["name"] != "qps" || labels["region"] != "eu" {
+		t.FailNow()
+	}
+	if c.Advance(now, 0) != c2.Advance(now, 0) {
+		t.FailNow()
+	}
+}
+
+func TestLoadAndContinue(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, minute, 60)
+	for i := 0; i < 60; i++ {
+		c.Advance(now, 10)
+		now += second
+	}
+	s := c.(Snapshotter).Snapshot()
+
+	// Restored 30s later, half of the history has expired.
+	now += 30 * second
+	c2 := NewSlidingWindow(now, minute, 60)
+	c2.(SnapshotContinuer).LoadAndContinue(s, now)
+	if count := c2.Advance(now, 0); count != 300 {
+		t.Log(count)
+		t.FailNow()
+	}
+
+	// Advances racing with the load are either replaced by it or applied
+	// after it, never lost in between.
+	c3 := NewSlidingWindow(now, minute, 60)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			c3.Advance(now, 1)
+		}
+	}()
+	c3.(SnapshotContinuer).LoadAndContinue(s, now)
+	<-done
+	if count := c3.Advance(now, 0); count < 300 || count > 1300 {
+		t.Log(count)
+		t.FailNow()
+	}
+}
+
+func TestMigrateSnapshot(t *testing.T) {
+	v1 := []byte(`{"start":1000,"end":3500,"step":1000,"deltas":[1,2,3],"labels":{"name":"qps"}}`)
+	s, err := MigrateSnapshot(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != SnapshotVersion || s.Start != 1000 || s.End != 3500 || s.Step != 1000 ||
+		len(s.Deltas) != 3 || s.Deltas[2] != 3 || s.Labels["name"] != "qps" {
+		t.FailNow()
+	}
+
+	c := NewSlidingWindow(0, 60000, 60)
+	c.(Snapshotter).LoadSnapshot(s)
+	if c.Advance(3500, 0) != 6 {
+		t.FailNow()
+	}
+
+	data, _ := json.Marshal(c.(Snapshotter).Snapshot())
+	s2, err := MigrateSnapshot(data)
+	if err != nil || s2.Version != SnapshotVersion || len(s2.Deltas) != 3 {
+		t.FailNow()
+	}
+
+	if _, err := MigrateSnapshot([]byte(`{"version":99}`)); err != ErrSnapshotVersion {
+		t.FailNow()
+	}
+	if _, err := MigrateSnapshot([]byte(`{`)); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestDumpDownsampled(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewSlidingWindow(now, 60*minute, 3600)
+	for i := 0; i < 5000; i++ {
+		c.Advance(now, int64(i%13))
+		now += second
+	}
+
+	c.Advance(now, 0)
+	var total int64
+	for _, d := range c.(Snapshotter).Snapshot().Deltas {
+		total += d
+	}
+
+	for _, max := range []int{1, 7, 100, 3601, 5000} {
+		s := c.(Downsampler).DumpDownsampled(now, max)
+		var sum int64
+		for _, d := range s.Deltas {
+			sum += d
+		}
+		t.Log(max, len(s.Deltas), s.Step)
+		if sum != total || len(s.Deltas) > max {
+			t.FailNow()
+		}
+	}
+
+	s := c.(Downsampler).DumpDownsampled(now, 60)
+	c2 := NewSlidingWindow(now, 60*minute, 3600)
+	c2.(Snapshotter).LoadSnapshot(s)
+	if diff := c.Advance(now, 0) - c2.Advance(now, 0); diff < -100 || diff > 100 {
+		t.Log(diff)
+		t.FailNow()
+	}
+}
+
+func TestSnapshotCanonical(t *testing.T) {
+	base := time.Now().UnixMilli()
+	var out [2][]byte
+	var count, dur int64
+	for k, start := range []int64{base, base + 12345} {
+		c := NewSlidingWindow(start, minute, 60)
+		now := start
+		for i := 0; i < 40; i++ {
+			c.Advance(now, int64(i%3))
+			now += 1500
+		}
+		count = c.Advance(now+5*second, 0)
+		dur = c.Duration()
+
+		data, err := json.Marshal(c.(Snapshotter).Snapshot().Canonical())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[k] = data
+	}
+	t.Log(string(out[0]))
+	if string(out[0]) != string(out[1]) {
+		t.FailNow()
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(out[0], &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Start != 0 || s.Deltas[len(s.Deltas)-1] == 0 {
+		t.FailNow()
+	}
+	c := NewSlidingWindow(0, minute, 60)
+	c.(Snapshotter).LoadSnapshot(s)
+	if c.Duration() != dur || c.Advance(s.End, 0) != count {
+		t.FailNow()
+	}
+
+	// trimmed while the window is not full yet
+	c = NewSlidingWindow(base, minute, 60)
+	c.Advance(base+2*second, 3)
+	c.Advance(base+30*second+500, 0)
+	s = c.(Snapshotter).Snapshot().Canonical()
+	c2 := NewSlidingWindow(0, minute, 60)
+	c2.(Snapshotter).LoadSnapshot(s)
+	if len(s.Deltas) != 3 || c2.Duration() != c.Duration() || c2.Duration() != 30500 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import "sync"
+
+// TotalCounter is a sliding window that also keeps the lifetime total of
+// the same stream.
+type TotalCounter interface {
+	Counter
+	// Total returns the sum of all the deltas since the creation, minus
+	// what the window took back on revoke, a revoke of an expired slot
+	// takes nothing back. Expiry and Zero do not change it. The updates
+	// refused by a guard of the window are not counted, the ones it only
+	// clamped, see WithSlotCap and WithSaturation, are counted in full.
+	Total() int64
+}
+
+type slidingWithTotal struct {
+	l     sync.Mutex
+	w     *slidingWindow[nopLocker, *nopLocker]
+	total int64
+}
+
+// NewSlidingWithTotal creates a TotalCounter, both views are driven by
+// exactly the same calls under a single lock.
+func NewSlidingWithTotal(start, window int64, slots int, opts ...Option) TotalCounter {
+	return &slidingWithTotal{w: newSlidingWindow[nopLocker](start, window, slots, opts...)}
+}
+
+func (c *slidingWithTotal) Advance(now int64, delta int64) int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	count, err := c.w.AdvanceE(now, delta)
+	if !refused(err) && !c.w.frozen {
+		c.add(delta)
+	}
+	return count
+}
+
+// refused tells whether the window ignored the update, rather than
+// applied it partially.
+func refused(err error) bool {
+	return err == ErrMaxJump || err == ErrBackwardTime
+}
+
+func (c *slidingWithTotal) add(delta int64) {
+	if c.w.opts.saturate {
+		delta = saturate(delta, c.total)
+	}
+	c.total += delta
+}
+
+// Revoke takes back from the total only what the window took back, a
+// revoke beyond the slot or of an expired one does not drive it below.
+func (c *slidingWithTotal) Revoke(hist int64, delta int64) (count int64) {
+	var applied bool
+	defer c.w.emit(OpRevoke, 0, hist, delta, &count, &applied)
+	c.l.Lock()
+	defer c.l.Unlock()
+	applied = c.w.record(OpRevoke, 0, hist, delta)
+	c.add(-c.w.revoke(hist, delta))
+	return c.w.calculate()
+}
+
+// Radvance moves the delta in time, the total does not change unless the
+// window could not take back all of it, then the rest counts as new.
+func (c *slidingWithTotal) Radvance(now, hist int64, delta int64) (count int64) {
+	var applied bool
+	defer c.w.emit(OpRadvance, now, hist, delta, &count, &applied)
+	c.l.Lock()
+	defer c.l.Unlock()
+	applied = !c.w.frozen
+	count, removed, err := c.w.radvance(now, hist, delta)
+	if !refused(err) && applied {
+		c.add(delta - removed)
+	}
+	return count
+}
+
+func (c *slidingWithTotal) Zero() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.w.Zero()
+}
+
+func (c *slidingWithTotal) Duration() int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.w.Duration()
+}
+
+func (c *slidingWithTotal) Total() int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.total
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// UniqueCounter estimates the number of distinct keys observed in a
+// sliding window, it is safe for concurrent use by multiple goroutines.
+type UniqueCounter interface {
+	Observe(now int64, key []byte)
+	Estimate(now int64) int64
+}
+
+// uniqueWindow keeps a HyperLogLog sketch per slot, the live sketches are
+// merged by taking the register-wise maximum.
+type uniqueWindow struct {
+	l     sync.Mutex
+	seed  maphash.Seed
+	p     uint8
+	start int64
+	step  int64
+	now   int64
+	slots [][]uint8
+}
+
+// NewUniqueWindow creates a UniqueCounter with 2^precision registers per
+// slot, precision is clamped to [4, 16]. The standard error of the
+// estimate is about 1.04/sqrt(2^precision).
+func NewUniqueWindow(start, window int64, slots int, precision int) UniqueCounter {
+	if precision < 4 {
+		precision = 4
+	}
+	if precision > 16 {
+		precision = 16
+	}
+	c := &uniqueWindow{
+		seed:  maphash.MakeSeed(),
+		p:     uint8(precision),
+		start: start,
+		step:  window / int64(slots),
+		now:   start,
+		slots: make([][]uint8, slots),
+	}
+	for i := range c.slots {
+		c.slots[i] = make([]uint8, 1<<precision)
+	}
+	return c
+}
+
+func (c *uniqueWindow) Observe(now int64, key []byte) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.advance(now)
+
+	h := maphash.Bytes(c.seed, key)
+	idx := h >> (64 - c.p)
+	rho := uint8(bits.LeadingZeros64(h<<c.p|1<<(c.p-1))) + 1
+
+	regs := c.slots[c.current()%int64(len(c.slots))]
+	if rho > regs[idx] {
+		regs[idx] = rho
+	}
+}
+
+func (c *uniqueWindow) Estimate(now int64) int64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.advance(now)
+
+	m := 1 << c.p
+	merged := make([]uint8, m)
+	for _, regs := range c.slots {
+		for i, r := range regs {
+			if r > merged[i] {
+				merged[i] = r
+			}
+		}
+	}
+
+	var sum float64
+	var zeros int
+	for _, r := range merged {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	fm := float64(m)
+	est := hllAlpha(m) * fm * fm / sum
+	if est <= 2.5*fm && zeros > 0 {
+		est = fm * math.Log(fm/float64(zeros))
+	}
+	return int64(est + 0.5)
+}
+
+func hllAlpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+func (c *uniqueWindow) current() int64 {
+	current := (c.now - c.start) / c.step
+	if current < 0 {
+		current = 0
+	}
+	return current
+}
+
+func (c *uniqueWindow) advance(now int64) {
+	if now <= c.now {
+		return
+	}
+
+	C := int64(len(c.slots))
+	current := c.current()
+	next := (now - c.start) / c.step
+	c.now = now
+	if next <= current {
+		return
+	}
+
+	if next-current > C {
+		current = next - C
+	}
+	for i := current + 1; i <= next; i++ {
+		regs := c.slots[i%C]
+		for j := range regs {
+			regs[j] = 0
+		}
+	}
+}
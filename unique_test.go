@@ -0,0 +1,52 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUniqueWindow(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := NewUniqueWindow(now, minute, 60, 12)
+	bound := 4 * 1.04 / math.Sqrt(1<<12)
+
+	within := func(est, want int64) bool {
+		return math.Abs(float64(est-want)) <= bound*float64(want)
+	}
+
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 1000; j++ {
+			// Every key shows up in two consecutive slots.
+			c.Observe(now, []byte(strconv.Itoa(i*500+j)))
+		}
+		now += second
+	}
+	est := c.Estimate(now)
+	t.Log(est)
+	if !within(est, 15500) {
+		t.FailNow()
+	}
+
+	for i := 0; i < 10; i++ {
+		c.Observe(now, []byte("only"))
+	}
+	if est := c.Estimate(now); !within(est, 15501) {
+		t.FailNow()
+	}
+
+	now += minute
+	if est := c.Estimate(now); est != 0 {
+		t.Log(est)
+		t.FailNow()
+	}
+	c.Observe(now, []byte("only"))
+	if est := c.Estimate(now); est != 1 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"math"
+	"sync"
+)
+
+// VarianceCounter tells how bursty a window is.
+type VarianceCounter interface {
+	Counter
+	// Variance advances to now and returns the population variance of
+	// the slot totals, over the live slots without the guard slot, or
+	// over the slots so far while the window is not full yet.
+	Variance(now int64) float64
+	// StdDev is the square root of Variance.
+	StdDev(now int64) float64
+}
+
+// NewVarianceWindow is like NewSlidingWindow, but also keeps the rolling
+// sum of the squared slot totals, so that Variance is O(1).
+func NewVarianceWindow(start, window int64, slots int, opts ...Option) VarianceCounter {
+	opts = append(opts[:len(opts):len(opts)], func(o *options) { o.variance = true })
+	return newSlidingWindow[sync.Mutex](start, window, slots, opts...)
+}
+
+func (c *slidingWindow[L, PL]) Variance(now int64) float64 {
+	PL(&c.l).Lock()
+	defer PL(&c.l).Unlock()
+	c.peek(now)
+	return c.variance()
+}
+
+func (c *slidingWindow[L, PL]) StdDev(now int64) float64 {
+	return math.Sqrt(c.Variance(now))
+}
+
+func (c *slidingWindow[L, PL]) variance() float64 {
+	C := int64(len(c.slots))
+	_, current := c.live()
+	n := current + 1
+	if n > C-1 {
+		n = C - 1
+	}
+
+	// The guard slot is current+1, it is zero until the ring wraps.
+	guard := float64(c.get(current + 1))
+	sum := float64(c.count) - guard
+	var sumsq float64
+	if c.opts.variance {
+		sumsq = c.sumsq - guard*guard
+	} else {
+		for i := current - n + 1; i <= current; i++ {
+			v := float64(c.get(i))
+			sumsq += v * v
+		}
+	}
+
+	mean := sum / float64(n)
+	v := sumsq/float64(n) - mean*mean
+	if v < 0 {
+		v = 0
+	}
+	return v
+}
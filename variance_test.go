@@ -0,0 +1,62 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package counter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVarianceWindow(t *testing.T) {
+	smooth := NewVarianceWindow(0, minute, 60)
+	spiky := NewVarianceWindow(0, minute, 60)
+	for i := int64(0); i < 120; i++ {
+		smooth.Advance(i*second, 10)
+		if i%10 == 0 {
+			spiky.Advance(i*second, 100)
+		}
+	}
+
+	now := 119*second + 500
+	if smooth.Variance(now) != 0 {
+		t.FailNow()
+	}
+	if spiky.Variance(now) != 900 || spiky.StdDev(now) != 30 {
+		t.Log(spiky.Variance(now))
+		t.FailNow()
+	}
+
+	// not full yet
+	c := NewVarianceWindow(0, minute, 60)
+	c.Advance(0, 4)
+	c.Advance(second, 0)
+	if c.Variance(second) != 4 {
+		t.FailNow()
+	}
+
+	if c.Variance(10*minute) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestVarianceScan(t *testing.T) {
+	kept := NewVarianceWindow(0, minute, 60)
+	scanned := NewSlidingWindow(0, minute, 60).(VarianceCounter)
+
+	var now int64
+	for i := int64(0); i < 3000; i++ {
+		now += (i * 7919) % (3 * second)
+		delta := i % 17
+		kept.Advance(now, delta)
+		scanned.Advance(now, delta)
+		if i%3 == 0 {
+			kept.Revoke(now-i%minute, 5)
+			scanned.Revoke(now-i%minute, 5)
+		}
+		if math.Abs(kept.Variance(now)-scanned.Variance(now)) > 1e-6 {
+			t.FailNow()
+		}
+	}
+}